@@ -0,0 +1,191 @@
+package analysis
+
+import (
+	"monkey/ast"
+	"monkey/builtins"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestEffects(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Effect
+	}{
+		{"1 + 2 * x", Pure},
+		{"[1, len(a)][0]", Pure},
+		{`{"a": first(xs)}`, Pure},
+		{"fn() { puts(1) }", Pure}, // 作るだけでは本体は評価されない
+		{"puts(1)", EffectIO},
+		{"help(\"len\")", EffectIO},
+		{"x++", EffectMutation},
+		{"--x + puts(1)", EffectMutation | EffectIO},
+		{"f(1)", EffectUnknownCall},
+		{"f(1)(2)", EffectUnknownCall},
+		{"quote(puts(1))", Pure},
+		{"if (x) { puts(1) } else { 2 }", EffectIO},
+		// 名前で呼び出す関数は本体の作用を調べる
+		{"let f = fn(x) { x + 1 }; f(2)", Pure},
+		{"let f = fn(x) { puts(x) }; f(2)", EffectIO},
+		{"fn(x) { x * 2 }(3)", Pure},
+		// 関数の局所変数の書き換えは外から見えない
+		{"let f = fn(x) { x++; let y = 0; y++; x }; f(1)", Pure},
+		{"let f = fn() { for (let i = 0; i < 3; i++) {} }; f()", Pure},
+		{"let n = 0; let f = fn() { n++ }; f()", EffectMutation},
+		// 捕捉した変数を書き換えるクロージャは、呼び出すと作用がある
+		{"let counter = fn() { let c = 0; fn() { c++ } }; counter()", Pure},
+		{"let counter = fn() { let c = 0; fn() { c++ } }; counter()()", EffectUnknownCall},
+		// 引数で受け取った関数を呼び出すと、作用がわからない
+		{"let apply = fn(g, x) { g(x) }; apply(len, [1])", EffectUnknownCall},
+		// 再帰している関数も、呼び出し先の作用を含める
+		{"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5)", Pure},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { puts(n) } else { even(n - 1) } }; even(4)", EffectIO},
+		// 組み込み関数の名前は束縛し直しても組み込み関数を指す
+		{"let g = fn(len) { len(1) }; len(1)", Pure},
+		{"let len = fn(x) { puts(x) }; len(1)", Pure},
+		{"let puts = fn(x) { x }; puts(1)", EffectIO},
+		{"let quote = fn(x) { puts(x) }; quote(1)", Pure},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info := Analyze(program)
+
+		// 最後の文の作用を調べる
+		last := program.Statements[len(program.Statements)-1]
+		got := info.Effects(last)
+		if got != tt.expected {
+			t.Errorf("wrong effects for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFunctionEffects(t *testing.T) {
+	program := parse(t, "let pure = fn(x) { x * 2 }; let impure = fn(x) { puts(x); x }")
+	info := Analyze(program)
+
+	pure := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	impure := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+
+	if e := info.FunctionEffects(pure); !e.IsPure() {
+		t.Errorf("pure function has effects %s", e)
+	}
+	if e := info.FunctionEffects(impure); e != EffectIO {
+		t.Errorf("wrong effects for impure function. want=%s, got=%s", EffectIO, e)
+	}
+
+	other := parse(t, "fn() { 1 }").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if e := info.FunctionEffects(other); e != EffectUnknownCall {
+		t.Errorf("function outside the program should be unknown. got=%s", e)
+	}
+}
+
+func TestEffectString(t *testing.T) {
+	tests := []struct {
+		effect   Effect
+		expected string
+	}{
+		{Pure, "pure"},
+		{EffectIO, "io"},
+		{EffectIO | EffectMutation, "io|mutation"},
+		{EffectNondeterminism | EffectUnknownCall, "nondeterminism|unknown-call"},
+	}
+
+	for _, tt := range tests {
+		if tt.effect.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, tt.effect.String())
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	input := `let x = 1;
+x + 1;
+puts(x);
+let f = fn(y) {
+  y * 2;
+  y++;
+  len(y);
+  y
+};
+f(x)`
+
+	expected := []string{
+		"2:1: result of pure expression (x + 1) is unused",
+		"5:3: result of pure expression (y * 2) is unused",
+		"7:3: result of pure expression len(y) is unused",
+	}
+
+	warnings := Lint(parse(t, input))
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong number of warnings. want=%d, got=%d (%v)", len(expected), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.String() != expected[i] {
+			t.Errorf("warnings[%d] wrong. want=%q, got=%q", i, expected[i], w.String())
+		}
+	}
+}
+
+func TestLintShadowedBuiltin(t *testing.T) {
+	// puts を let で束縛し直しても、呼び出すのは組み込み関数の puts なので警告しない
+	warnings := Lint(parse(t, "let puts = fn(x) { x }; puts(1); 2;"))
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestBuiltinEffects(t *testing.T) {
+	// 評価器のすべての組み込み関数の作用がわかる
+	for _, name := range builtins.Names() {
+		if _, ok := builtinEffects[name]; !ok {
+			t.Errorf("no effects for builtin %s", name)
+		}
+	}
+	if builtinEffects["puts"] != EffectIO || builtinEffects["len"] != Pure {
+		t.Errorf("wrong builtin effects. puts=%s, len=%s", builtinEffects["puts"], builtinEffects["len"])
+	}
+}
+
+func TestAnalysisDoesNotModifyProgram(t *testing.T) {
+	input := `let f = fn(x) { {"a": x, "b": puts(x)} }; 1; f(2)["a"]`
+	program := parse(t, input)
+	// String() はハッシュの組を決まった順に並べないので、Source で比べる
+	expected, err := ast.Source(program)
+	if err != nil {
+		t.Fatalf("Source returned error: %v", err)
+	}
+
+	var hash *ast.HashLiteral
+	ast.Inspect(program, func(node ast.Node) bool {
+		if h, ok := node.(*ast.HashLiteral); ok {
+			hash = h
+		}
+		return true
+	})
+	pairs := reflect.ValueOf(hash.Pairs).Pointer()
+
+	Analyze(program)
+	Lint(program)
+
+	if got, _ := ast.Source(program); got != expected {
+		t.Errorf("program changed. want=%q, got=%q", expected, got)
+	}
+	if reflect.ValueOf(hash.Pairs).Pointer() != pairs {
+		t.Errorf("pairs of the hash literal were replaced")
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
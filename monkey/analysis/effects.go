@@ -0,0 +1,309 @@
+// 構文木を静的に調べる解析。最適化やリンタなどのツールから使う
+package analysis
+
+import (
+	"monkey/ast"
+	"monkey/builtins"
+	"strings"
+)
+
+// 式を評価した時に外から観測できる作用の集合。0 (Pure) は作用がないことを表す。
+// エラーになるかどうかは作用に含めない。純粋な式でも 1 / 0 のように評価するとエラーになることがある
+type Effect uint
+
+const (
+	EffectIO             Effect = 1 << iota // puts や help で出力する
+	EffectMutation                          // ++ や -- で式の外側の変数を書き換える
+	EffectNondeterminism                    // 同じ引数でも結果が変わりうる
+	EffectUnknownCall                       // 作用のわからない関数を呼び出す。引数で受け取った関数など
+
+	Pure Effect = 0
+)
+
+var effectNames = []struct {
+	effect Effect
+	name   string
+}{
+	{EffectIO, "io"},
+	{EffectMutation, "mutation"},
+	{EffectNondeterminism, "nondeterminism"},
+	{EffectUnknownCall, "unknown-call"},
+}
+
+// 作用の名前を | でつないで返す。たとえば "io|mutation"。作用がない時は "pure"
+func (e Effect) String() string {
+	if e == Pure {
+		return "pure"
+	}
+
+	names := []string{}
+	for _, n := range effectNames {
+		if e&n.effect != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (e Effect) IsPure() bool { return e == Pure }
+
+// 組み込み関数を呼び出した時の作用。builtins パッケージの組み込み関数の Spec から作る。
+// ここにない組み込み関数(Spec のないもの)は、作用がわからないものとして扱う
+var builtinEffects = func() map[string]Effect {
+	effects := map[string]Effect{}
+	for _, name := range builtins.Names() {
+		builtin, _ := builtins.Lookup(name)
+		if builtin.Spec == nil {
+			continue
+		}
+		e := Pure
+		if builtin.Spec.IO {
+			e |= EffectIO
+		}
+		if builtin.Spec.Nondeterministic {
+			e |= EffectNondeterminism
+		}
+		effects[name] = e
+	}
+	return effects
+}()
+
+// プログラムを解析した結果。式や関数の作用を問い合わせる
+type Info struct {
+	named     map[string]*ast.FunctionLiteral // 一度だけ束縛される、組み込み関数でない名前と、その名前に束縛した関数リテラル
+	functions map[*ast.FunctionLiteral]Effect // 関数リテラルを呼び出した時の作用
+}
+
+// プログラムの中の関数の作用を求める。
+// 名前で呼び出す関数は、その名前がプログラムの中で一度だけ let で関数リテラルに束縛されている時にだけ中身を調べる。
+// 再帰している関数は、作用が変わらなくなるまで繰り返し求める
+func Analyze(program *ast.Program) *Info {
+	info := &Info{
+		named:     map[string]*ast.FunctionLiteral{},
+		functions: map[*ast.FunctionLiteral]Effect{},
+	}
+
+	bindings := map[string]int{}
+	literals := []*ast.FunctionLiteral{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bindings[node.Name.Value]++
+			if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+				info.named[node.Name.Value] = fn
+			}
+		case *ast.FunctionLiteral:
+			literals = append(literals, node)
+			for _, p := range node.Parameters {
+				bindings[p.Value]++
+			}
+		case *ast.MacroLiteral:
+			return false // マクロの本体は展開されるまで評価されない
+		}
+		return true
+	})
+	for name, n := range bindings {
+		// 評価器は組み込み関数を環境より先に探すので、組み込み関数の名前は let で束縛しても組み込み関数を指す
+		if _, ok := builtinEffects[name]; n != 1 || ok {
+			delete(info.named, name)
+		}
+	}
+
+	// すべての関数を純粋だと仮定して始め、呼び出し先の作用を足していく。作用は増える一方なので必ず止まる
+	for _, fn := range literals {
+		info.functions[fn] = Pure
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range literals {
+			e := info.bodyEffects(fn)
+			if e != info.functions[fn] {
+				info.functions[fn] = e
+				changed = true
+			}
+		}
+	}
+
+	return info
+}
+
+// node を評価した時の作用を返す。関数リテラルは作るだけでは作用がなく、呼び出した時に本体の作用が起きる
+func (info *Info) Effects(node ast.Node) Effect {
+	return info.effects(node, nil)
+}
+
+// 解析したプログラムの中の関数リテラルを呼び出した時の作用を返す
+func (info *Info) FunctionEffects(fn *ast.FunctionLiteral) Effect {
+	e, ok := info.functions[fn]
+	if !ok {
+		return EffectUnknownCall
+	}
+	return e
+}
+
+// node を評価しても外から観測できる作用がないかどうか
+func (info *Info) IsPure(node ast.Node) bool {
+	return info.Effects(node).IsPure()
+}
+
+// 関数の本体の作用。仮引数と本体で let した変数は呼び出しごとに作られるので、それを書き換えても外からは見えない
+func (info *Info) bodyEffects(fn *ast.FunctionLiteral) Effect {
+	locals := map[string]bool{}
+	for _, p := range fn.Parameters {
+		locals[p.Value] = true
+	}
+	collectLocals(fn.Body, locals)
+
+	return info.effects(fn.Body, locals)
+}
+
+// 関数の本体で let した名前を集める。内側の関数リテラルの中は、その関数の変数なので含めない
+func collectLocals(node ast.Node, locals map[string]bool) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			collectLocals(s, locals)
+		}
+	case *ast.LetStatement:
+		locals[node.Name.Value] = true
+	case *ast.ForStatement:
+		if node.Init != nil {
+			locals[node.Init.Name.Value] = true
+		}
+		collectLocals(node.Body, locals)
+	case *ast.ExpressionStatement:
+		if ifExpr, ok := node.Expression.(*ast.IfExpression); ok {
+			collectLocals(ifExpr.Consequence, locals)
+			if ifExpr.Alternative != nil {
+				collectLocals(ifExpr.Alternative, locals)
+			}
+		}
+	}
+}
+
+// locals は解析している関数の局所変数の集合。トップレベルでは nil
+func (info *Info) effects(node ast.Node, locals map[string]bool) Effect {
+	switch node := node.(type) {
+	case *ast.Program:
+		e := Pure
+		for _, s := range node.Statements {
+			e |= info.effects(s, locals)
+		}
+		return e
+
+	case *ast.BlockStatement:
+		e := Pure
+		for _, s := range node.Statements {
+			e |= info.effects(s, locals)
+		}
+		return e
+
+	case *ast.ExpressionStatement:
+		return info.effects(node.Expression, locals)
+
+	case *ast.LetStatement:
+		return info.effects(node.Value, locals)
+
+	case *ast.ReturnStatement:
+		return info.effects(node.ReturnValue, locals)
+
+	case *ast.ForStatement:
+		e := Pure
+		if node.Init != nil {
+			e |= info.effects(node.Init, locals)
+		}
+		if node.Condition != nil {
+			e |= info.effects(node.Condition, locals)
+		}
+		if node.Post != nil {
+			e |= info.effects(node.Post, locals)
+		}
+		return e | info.effects(node.Body, locals)
+
+	case *ast.PrefixExpression:
+		e := info.effects(node.Right, locals)
+		if node.Operator == "++" || node.Operator == "--" {
+			e |= mutationOf(node.Right, locals)
+		}
+		return e
+
+	case *ast.PostfixExpression:
+		return info.effects(node.Left, locals) | mutationOf(node.Left, locals)
+
+	case *ast.InfixExpression:
+		return info.effects(node.Left, locals) | info.effects(node.Right, locals)
+
+	case *ast.IndexExpression:
+		return info.effects(node.Left, locals) | info.effects(node.Index, locals)
+
+	case *ast.IfExpression:
+		e := info.effects(node.Condition, locals) | info.effects(node.Consequence, locals)
+		if node.Alternative != nil {
+			e |= info.effects(node.Alternative, locals)
+		}
+		return e
+
+	case *ast.ArrayLiteral:
+		e := Pure
+		for _, el := range node.Elements {
+			e |= info.effects(el, locals)
+		}
+		return e
+
+	case *ast.HashLiteral:
+		e := Pure
+		for k, v := range node.Pairs {
+			e |= info.effects(k, locals) | info.effects(v, locals)
+		}
+		return e
+
+	case *ast.CallExpression:
+		return info.callEffects(node, locals)
+
+	case *ast.InlinedCall:
+		return info.effects(node.Body, locals)
+
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean,
+		*ast.FunctionLiteral, *ast.MacroLiteral:
+		return Pure
+
+	default:
+		return EffectUnknownCall // 知らない種類のノードは、何が起きるかわからないものとして扱う
+	}
+}
+
+// 呼び出し先の作用に、呼び出す関数と引数を評価する作用を足す
+func (info *Info) callEffects(call *ast.CallExpression, locals map[string]bool) Effect {
+	if ident, ok := call.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+		return Pure // quote の引数は評価されない。評価器は quote を束縛し直しても特別な形式として扱う
+	}
+
+	e := info.effects(call.Function, locals)
+	for _, arg := range call.Arguments {
+		e |= info.effects(arg, locals)
+	}
+
+	switch fn := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		return e | info.FunctionEffects(fn)
+
+	case *ast.Identifier:
+		// 組み込み関数の名前は束縛し直せないので、先に調べる
+		if builtin, ok := builtinEffects[fn.Value]; ok {
+			return e | builtin
+		}
+		if literal, ok := info.named[fn.Value]; ok {
+			return e | info.FunctionEffects(literal)
+		}
+	}
+
+	return e | EffectUnknownCall
+}
+
+// 識別子を ++ や -- で書き換える作用。解析している関数の局所変数なら外からは見えない
+func mutationOf(target ast.Expression, locals map[string]bool) Effect {
+	if ident, ok := target.(*ast.Identifier); ok && locals[ident.Value] {
+		return Pure
+	}
+	return EffectMutation
+}
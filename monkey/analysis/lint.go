@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+// リンタの警告
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w *Warning) String() string {
+	return w.Pos.String() + ": " + w.Message
+}
+
+// 値が使われない純粋な式文を警告する。
+// プログラムとブロックの値は最後の文の値なので、最後の文は警告しない。
+// 純粋な式文は取り除いても結果が変わらない(エラーになる式を除く)ので、書き間違いのことが多い
+func Lint(program *ast.Program) []*Warning {
+	info := Analyze(program)
+	warnings := []*Warning{}
+
+	check := func(statements []ast.Statement) {
+		for i, s := range statements {
+			if i == len(statements)-1 {
+				break
+			}
+			es, ok := s.(*ast.ExpressionStatement)
+			if !ok || es.Expression == nil || !info.IsPure(es.Expression) {
+				continue
+			}
+			warnings = append(warnings, &Warning{
+				Pos:     es.Token.Pos(),
+				Message: "result of pure expression " + es.Expression.String() + " is unused",
+			})
+		}
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			check(node.Statements)
+		case *ast.BlockStatement:
+			check(node.Statements)
+		}
+		return true
+	})
+
+	// 外側のブロックの警告が、その中のブロックの警告より先に並ぶので、位置の順に並べ直す
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i].Pos, warnings[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return warnings
+}
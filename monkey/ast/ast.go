@@ -3,11 +3,13 @@ package ast
 import (
 	"bytes"
 	"monkey/token"
+	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Kind() NodeKind // 型アサーションを使わずにノードの種類を判定するための値
 }
 
 type Statement interface {
@@ -24,6 +26,8 @@ type Program struct {
 	Statements []Statement
 }
 
+func (p *Program) Kind() NodeKind { return KindProgram }
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
@@ -41,6 +45,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Kind() NodeKind       { return KindLetStatement }
 
 // 識別子のASTノード
 type Identifier struct {
@@ -50,6 +55,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Kind() NodeKind       { return KindIdentifier }
 func (i *Identifier) String() string       { return i.Value }
 
 // return文のASTノード
@@ -60,6 +66,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Kind() NodeKind       { return KindReturnStatement }
 
 // 式文のASTノード
 type ExpressionStatement struct {
@@ -69,6 +76,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Kind() NodeKind       { return KindExpressionStatement }
 
 // 整数リテラルのASTノード
 type IntegerLiteral struct {
@@ -78,8 +86,112 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Kind() NodeKind       { return KindIntegerLiteral }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// 浮動小数点数リテラルのASTノード
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Kind() NodeKind       { return KindFloatLiteral }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+// 文字列リテラルのASTノード
+type StringLiteral struct {
+	Token token.Token // token.STRING トークン
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Kind() NodeKind       { return KindStringLiteral }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// 配列リテラルのASTノード
+type ArrayLiteral struct {
+	Token    token.Token // '[' トークン
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Kind() NodeKind       { return KindArrayLiteral }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// ハッシュリテラルのASTノード。たとえば {"one": 1, "two": 2}
+type HashLiteral struct {
+	Token token.Token // '{' トークン
+	Pairs map[Expression]Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Kind() NodeKind       { return KindHashLiteral }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for key, value := range hl.Pairs {
+		pairs = append(pairs, key.String()+":"+value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// 添字演算子のASTノード。たとえば myArray[1 + 1]
+type IndexExpression struct {
+	Token token.Token // '[' トークン
+	Left  Expression  // 添字でアクセスされる側の式
+	Index Expression  // 添字の式
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Kind() NodeKind       { return KindIndexExpression }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// 真偽値のASTノード
+type Boolean struct {
+	Token token.Token // token.TRUE か token.FALSE トークン
+	Value bool
+}
+
+func (b *Boolean) expressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Kind() NodeKind       { return KindBoolean }
+func (b *Boolean) String() string       { return b.Token.Literal }
+
 // 前置演算子のASTノード
 type PrefixExpression struct {
 	Token    token.Token // 前置トークン。たとえば「！」
@@ -89,6 +201,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Kind() NodeKind       { return KindPrefixExpression }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -99,6 +212,26 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// 後置演算子式のASTノード。たとえば「x++」
+type PostfixExpression struct {
+	Token    token.Token // 後置トークン
+	Left     Expression  // 演算子の左側の式
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Kind() NodeKind       { return KindPostfixExpression }
+func (pe *PostfixExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(pe.Operator)
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token // 演算子トークン、たとえば「＋」
 	Left     Expression
@@ -108,6 +241,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Kind() NodeKind       { return KindInfixExpression }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -120,6 +254,202 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// 関数リテラルのASTノード。たとえば fn(x, y) { x + y; }
+type FunctionLiteral struct {
+	Token      token.Token // 'fn' トークン
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Kind() NodeKind       { return KindFunctionLiteral }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+// マクロリテラルのASTノード。たとえば macro(x, y) { quote(unquote(x) + unquote(y)); }
+type MacroLiteral struct {
+	Token      token.Token // 'macro' トークン
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Kind() NodeKind       { return KindMacroLiteral }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// 関数呼び出しのASTノード。たとえば add(1, 2 * 3)
+type CallExpression struct {
+	Token     token.Token // '(' トークン
+	Function  Expression  // 識別子か関数リテラル
+	Arguments []Expression
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Kind() NodeKind       { return KindCallExpression }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// if式のASTノード
+type IfExpression struct {
+	Token       token.Token // 'if' トークン
+	Condition   Expression  // 条件の式
+	Consequence *BlockStatement
+	Alternative *BlockStatement // else がない時には nil のまま
+}
+
+func (ie *IfExpression) expressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Kind() NodeKind       { return KindIfExpression }
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// 波括弧で囲まれた一連の文のASTノード
+type BlockStatement struct {
+	Token      token.Token // '{' トークン
+	Statements []Statement
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Kind() NodeKind       { return KindBlockStatement }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+
+	return out.String()
+}
+
+// for (<初期化>; <条件>; <後処理>) { <本体> } の形の for 文のASTノード
+type ForStatement struct {
+	Token     token.Token          // 'for' トークン
+	Init      *LetStatement        // 省略された時には nil のまま
+	Condition Expression           // 省略された時には nil のまま。条件がない時は常に真として扱う
+	Post      *ExpressionStatement // 省略された時には nil のまま
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Kind() NodeKind       { return KindForStatement }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(fs.Init.String()) // let 文の String() は ';' で終わる
+	} else {
+		out.WriteString(";")
+	}
+	out.WriteString(" ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// 最適化で関数の本体に展開した呼び出しのASTノード。構文解析器は作らない。
+// 評価すると Body の値になり、エラーになった時は展開する前の呼び出しをスタックトレースに記録する
+type InlinedCall struct {
+	Token    token.Token // 展開する前の呼び出しの '(' トークン
+	Function *Identifier // 展開する前に呼び出していた関数の名前
+	Body     Expression  // 仮引数を実引数で置き換えた関数の本体
+}
+
+func (ic *InlinedCall) expressionNode()      {}
+func (ic *InlinedCall) TokenLiteral() string { return ic.Token.Literal }
+func (ic *InlinedCall) Kind() NodeKind       { return KindInlinedCall }
+func (ic *InlinedCall) String() string       { return ic.Body.String() }
+
+// 構文解析に失敗した式の代わりに木に入るノード。木をたどる処理が nil を気にしなくてすむように、nil の代わりに使う
+type BadExpression struct {
+	Token token.Token // 失敗した式の最初のトークン
+	Err   error       // この式の構文解析で記録されたエラー
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) Kind() NodeKind       { return KindBadExpression }
+func (be *BadExpression) String() string       { return "<bad expression>" }
+
+// 構文解析に失敗した文の代わりに木に入るノード
+type BadStatement struct {
+	Token token.Token // 失敗した文の最初のトークン
+	Err   error       // この文の構文解析で記録されたエラー
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) Kind() NodeKind       { return KindBadStatement }
+func (bs *BadStatement) String() string       { return "<bad statement>" }
+
 func (p *Program) String() string {
 	var out bytes.Buffer // データを受け取るバッファを用意する
 
@@ -1,7 +1,11 @@
 package ast
 
 import (
+	"fmt"
+	"math"
 	"monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -11,7 +15,7 @@ func TestString(t *testing.T) {
 			&LetStatement{
 				Token: token.Token{Type: token.LET, Literal: "let"},
 				Name: &Identifier{
-					Token: tokentoken.Token{Type: token.IDENT, Literal: myVar},
+					Token: token.Token{Type: token.IDENT, Literal: "myVar"},
 					Value: "myVar",
 				},
 				Value: &Identifier{
@@ -26,3 +30,505 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestNodeString(t *testing.T) {
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	y := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "y"}, Value: "y"}
+	one := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	two := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	sum := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+"},
+		Left:     x,
+		Operator: "+",
+		Right:    y,
+	}
+	block := &BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+		Statements: []Statement{&ExpressionStatement{Token: sum.Token, Expression: sum}},
+	}
+
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{x, "x"},
+		{one, "1"},
+		{&StringLiteral{Token: token.Token{Type: token.STRING, Literal: "hello"}, Value: "hello"}, "hello"},
+		{&Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}, "true"},
+		{&PrefixExpression{Token: token.Token{Type: token.MINUS, Literal: "-"}, Operator: "-", Right: x}, "(-x)"},
+		{&PostfixExpression{Token: token.Token{Type: token.BANG, Literal: "!"}, Left: x, Operator: "!"}, "(x!)"},
+		{sum, "(x + y)"},
+		{&InfixExpression{Token: sum.Token, Left: sum, Operator: "+", Right: one}, "((x + y) + 1)"},
+		{&ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: []Expression{one, two}}, "[1, 2]"},
+		{&IndexExpression{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Left: x, Index: one}, "(x[1])"},
+		{&HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Pairs: map[Expression]Expression{x: sum}}, "{x:(x + y)}"},
+		{&HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}}, "{}"},
+		{&FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Parameters: []*Identifier{x, y}, Body: block}, "fn(x, y) (x + y)"},
+		{&MacroLiteral{Token: token.Token{Type: token.MACRO, Literal: "macro"}, Parameters: []*Identifier{x, y}, Body: block}, "macro(x, y) (x + y)"},
+		{&CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "("}, Function: x, Arguments: []Expression{one, sum}}, "x(1, (x + y))"},
+		{&IfExpression{Token: token.Token{Type: token.IF, Literal: "if"}, Condition: x, Consequence: block}, "ifx (x + y)"},
+		{&IfExpression{Token: token.Token{Type: token.IF, Literal: "if"}, Condition: x, Consequence: block, Alternative: block}, "ifx (x + y)else (x + y)"},
+		{block, "(x + y)"},
+		{&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: one}, "return 1;"},
+		{&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}}, "return ;"},
+		{&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: x, Value: sum}, "let x = (x + y);"},
+		{&ExpressionStatement{Token: sum.Token}, ""},
+		{&BadExpression{Token: sum.Token}, "<bad expression>"},
+		{&BadStatement{Token: token.Token{Type: token.LET, Literal: "let"}}, "<bad statement>"},
+		{&ForStatement{
+			Token:     token.Token{Type: token.FOR, Literal: "for"},
+			Init:      &LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: x, Value: one},
+			Condition: x,
+			Post:      &ExpressionStatement{Token: sum.Token, Expression: sum},
+			Body:      block,
+		}, "for (let x = 1; x; (x + y)) (x + y)"},
+		{&ForStatement{Token: token.Token{Type: token.FOR, Literal: "for"}, Body: block}, "for (; ; ) (x + y)"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.String() != tt.expected {
+			t.Errorf("tests[%d] - %T.String() wrong. expected=%q, got=%q",
+				i, tt.node, tt.expected, tt.node.String())
+		}
+	}
+}
+
+func TestNodeKind(t *testing.T) {
+	nodes := []Node{
+		&Program{},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&ForStatement{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&StringLiteral{},
+		&Boolean{},
+		&ArrayLiteral{},
+		&HashLiteral{},
+		&IndexExpression{},
+		&PrefixExpression{},
+		&PostfixExpression{},
+		&InfixExpression{},
+		&FunctionLiteral{},
+		&MacroLiteral{},
+		&CallExpression{},
+		&IfExpression{},
+		&InlinedCall{},
+		&BadExpression{},
+		&BadStatement{},
+	}
+
+	seen := map[NodeKind]bool{}
+	for _, node := range nodes {
+		// 種類の名前はノードの型の名前と同じになる
+		name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+		if node.Kind().String() != name {
+			t.Errorf("%T.Kind() wrong. expected=%s, got=%s", node, name, node.Kind())
+		}
+		if seen[node.Kind()] {
+			t.Errorf("%T.Kind() %s is used by another node", node, node.Kind())
+		}
+		seen[node.Kind()] = true
+	}
+
+	// ノードの型を追加した時に、ここのノードの一覧か種類の定義のどちらかを忘れていないか確かめる
+	if len(Kinds()) != len(nodes) {
+		t.Errorf("Kinds() has %d kinds, but there are %d nodes", len(Kinds()), len(nodes))
+	}
+	for _, k := range Kinds() {
+		if !seen[k] {
+			t.Errorf("no node has kind %s", k)
+		}
+	}
+	if KindInvalid.String() != "Invalid" || NodeKind(-1).String() != "NodeKind(?)" {
+		t.Errorf("wrong String() for non-node kinds. got=%s, %s", KindInvalid, NodeKind(-1))
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	nilNodes := []Node{
+		(*Program)(nil),
+		(*LetStatement)(nil),
+		(*ReturnStatement)(nil),
+		(*ExpressionStatement)(nil),
+		(*BlockStatement)(nil),
+		(*ForStatement)(nil),
+		(*Identifier)(nil),
+		(*IntegerLiteral)(nil),
+		(*FloatLiteral)(nil),
+		(*StringLiteral)(nil),
+		(*Boolean)(nil),
+		(*ArrayLiteral)(nil),
+		(*HashLiteral)(nil),
+		(*IndexExpression)(nil),
+		(*PrefixExpression)(nil),
+		(*PostfixExpression)(nil),
+		(*InfixExpression)(nil),
+		(*FunctionLiteral)(nil),
+		(*MacroLiteral)(nil),
+		(*CallExpression)(nil),
+		(*IfExpression)(nil),
+		(*InlinedCall)(nil),
+		(*BadExpression)(nil),
+		(*BadStatement)(nil),
+	}
+
+	// 種類を追加した時に、IsNil の switch に書き忘れていないか確かめる
+	if len(nilNodes) != len(Kinds()) {
+		t.Errorf("Kinds() has %d kinds, but there are %d nil nodes", len(Kinds()), len(nilNodes))
+	}
+	for _, node := range nilNodes {
+		if !IsNil(node) {
+			t.Errorf("IsNil(%T(nil)) returned false", node)
+		}
+	}
+
+	if !IsNil(nil) {
+		t.Errorf("IsNil(nil) returned false")
+	}
+	if IsNil(&Identifier{}) || IsNil(&Program{}) {
+		t.Errorf("IsNil returned true for a non-nil node")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	one := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	plus := token.Token{Type: token.PLUS, Literal: "+"}
+	block := &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}}
+	var nilExpression *Identifier // nil のポインタを入れた Expression
+
+	tests := []struct {
+		node     Node
+		expected string // 空文字列の時はエラーにならないことを期待する
+	}{
+		{&Program{Statements: []Statement{&ExpressionStatement{Expression: x}}}, ""},
+		{&Program{Statements: []Statement{&LetStatement{Name: x, Value: &InfixExpression{Token: plus, Left: x, Operator: "+", Right: one}}}}, ""},
+		{&ForStatement{Body: block}, ""},
+		{&IfExpression{Condition: x, Consequence: block}, ""},
+		{nil, "node is nil"},
+		{&Program{Statements: []Statement{nil}}, "Program.Statements[0] is nil"},
+		{&Program{Statements: []Statement{&LetStatement{Name: x}}}, "Program.Statements[0].Value is nil"},
+		{&ExpressionStatement{Expression: nilExpression}, "ExpressionStatement.Expression is nil"},
+		{&ReturnStatement{ReturnValue: &PrefixExpression{Token: token.Token{Type: token.MINUS, Literal: "-"}, Operator: "-"}}, "ReturnStatement.ReturnValue.Right is nil"},
+		{&InfixExpression{Token: plus, Left: x, Operator: "-", Right: one}, `InfixExpression.Operator is "-", but its token type is +`},
+		{&IfExpression{Condition: x}, "IfExpression.Consequence is nil"},
+		{&FunctionLiteral{Parameters: []*Identifier{x}}, "FunctionLiteral.Body is nil"},
+		{&MacroLiteral{Parameters: []*Identifier{nil}, Body: block}, "MacroLiteral.Parameters[0] is nil"},
+		{&CallExpression{Function: x, Arguments: []Expression{one, nil}}, "CallExpression.Arguments[1] is nil"},
+		{&ForStatement{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{}}}}, "ForStatement.Body.Statements[0].Expression is nil"},
+		{&Program{Statements: []Statement{&BadStatement{}}}, "Program.Statements[0] is a BadStatement"},
+		{&HashLiteral{Pairs: map[Expression]Expression{x: nil}}, "HashLiteral.Pairs value is nil"},
+		{&LetStatement{Name: x, Value: &BadExpression{}}, "LetStatement.Value is a BadExpression"},
+	}
+
+	for i, tt := range tests {
+		err := Validate(tt.node)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("tests[%d] - unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("tests[%d] - expected error %q, got nil", i, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	// 1 を 2 に置き換える
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&PostfixExpression{Left: one(), Operator: "++"},
+			&PostfixExpression{Left: two(), Operator: "++"},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&ForStatement{
+				Init:      &LetStatement{Value: one()},
+				Condition: one(),
+				Post:      &ExpressionStatement{Expression: one()},
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&ForStatement{
+				Init:      &LetStatement{Value: two()},
+				Condition: two(),
+				Post:      &ExpressionStatement{Expression: two()},
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), one()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		// マクロリテラルの中は書き換えない
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		equal := reflect.DeepEqual(modified, tt.expected)
+		if !equal {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+
+	// ハッシュのキーはポインタなので、DeepEqual ではなく値を一つずつ確かめる
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{
+			one(): one(),
+			one(): one(),
+		},
+	}
+
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	for key, val := range hashLiteral.Pairs {
+		key, _ := key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, key.Value)
+		}
+		val, _ := val.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.Value)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	// for (let i = 0; ; i++) { if (f(i)) { [i] } }
+	program := NewProgram(
+		NewFor(NewLet("i", NewInt(0)), nil, NewPostfix(NewIdent("i"), "++"), NewBlock(
+			NewExpressionStatement(NewIf(NewCall(NewIdent("f"), NewIdent("i")), NewBlock(
+				NewExpressionStatement(NewArray(NewIdent("i"))),
+			), nil)),
+		)),
+		NewExpressionStatement(NewMacro([]string{"x"}, NewBlock())),
+	)
+
+	visited := []string{}
+	Inspect(program, func(node Node) bool {
+		visited = append(visited, node.Kind().String())
+		return true
+	})
+
+	// 親は子より先に、省略した条件と else はたどらずに、マクロリテラルの中もたどる
+	expected := []string{
+		"Program", "ForStatement", "LetStatement", "Identifier", "IntegerLiteral",
+		"ExpressionStatement", "PostfixExpression", "Identifier",
+		"BlockStatement", "ExpressionStatement", "IfExpression", "CallExpression", "Identifier", "Identifier",
+		"BlockStatement", "ExpressionStatement", "ArrayLiteral", "Identifier",
+		"ExpressionStatement", "MacroLiteral", "Identifier", "BlockStatement",
+	}
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong nodes visited.\nwant=%v\ngot= %v", expected, visited)
+	}
+
+	// false を返すとそのノードの子はたどらない
+	visited = []string{}
+	Inspect(program, func(node Node) bool {
+		visited = append(visited, node.Kind().String())
+		_, isFor := node.(*ForStatement)
+		return !isFor
+	})
+	expected = []string{"Program", "ForStatement", "ExpressionStatement", "MacroLiteral", "Identifier", "BlockStatement"}
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong nodes visited when pruning.\nwant=%v\ngot= %v", expected, visited)
+	}
+
+	// Modify と違って、ハッシュリテラルの組を作り直さない
+	hash := NewHash(map[Expression]Expression{NewString("a"): NewInt(1)})
+	pairs := reflect.ValueOf(hash.Pairs).Pointer()
+	count := 0
+	Inspect(hash, func(node Node) bool {
+		count++
+		return true
+	})
+	if count != 3 {
+		t.Errorf("wrong number of nodes visited in hash literal. want=3, got=%d", count)
+	}
+	if reflect.ValueOf(hash.Pairs).Pointer() != pairs {
+		t.Errorf("Inspect replaced the pairs of the hash literal")
+	}
+}
+
+func TestSource(t *testing.T) {
+	x := NewIdent("x")
+
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{NewProgram(NewLet("x", NewInt(5)), NewExpressionStatement(x)), "let x = 5;\nx;"},
+		{NewReturn(NewInfix(NewInt(1), "+", NewInfix(NewInt(2), "*", NewInt(3)))), "return (1 + (2 * 3));"},
+		{NewExpressionStatement(NewInfix(NewInfix(NewInt(1), "+", NewInt(2)), "*", NewInt(3))), "((1 + 2) * 3);"},
+		{NewPrefix("-", NewPrefix("-", x)), "(-(-x))"},
+		{NewPostfix(x, "++"), "(x++)"},
+		{NewInt(-3), "(-3)"},
+		{NewInt(math.MinInt64), "(-9223372036854775807 - 1)"},
+		{NewFloat(2), "2.0"},
+		{NewFloat(-0.5), "(-0.5)"},
+		{NewString("say \"hi\"\n\tC:\\ 名前\x00"), `"say \"hi\"\n\tC:\\ 名前\u{0}"`},
+		{NewBool(false), "false"},
+		{NewArray(NewInt(1), NewString("a")), `[1, "a"]`},
+		{NewHash(map[Expression]Expression{NewString("b"): NewInt(2), NewString("a"): NewInt(1)}), `{"a": 1, "b": 2}`},
+		{NewIndex(NewArray(NewInt(1)), NewInt(0)), "([1][0])"},
+		{NewFunction([]string{"a", "b"}, NewBlock(NewReturn(NewInfix(NewIdent("a"), "+", NewIdent("b"))))), "fn(a, b) { return (a + b); }"},
+		{NewMacro(nil, NewBlock()), "macro() {}"},
+		{NewCall(NewIdent("add"), NewInt(1), NewInt(2)), "add(1, 2)"},
+		{NewCall(NewFunction([]string{"x"}, NewBlock(NewExpressionStatement(x))), NewInt(1)), "(fn(x) { x; })(1)"},
+		{NewIf(NewBool(true), NewBlock(NewExpressionStatement(NewInt(1))), nil), "if (true) { 1; }"},
+		{NewIf(x, NewBlock(), NewBlock(NewExpressionStatement(NewInt(2)))), "if (x) {} else { 2; }"},
+		{NewFor(NewLet("i", NewInt(0)), NewInfix(NewIdent("i"), "<", NewInt(3)), NewPostfix(NewIdent("i"), "++"), NewBlock()), "for (let i = 0; (i < 3); (i++)) {}"},
+		{NewFor(nil, nil, nil, NewBlock()), "for (;;) {}"},
+	}
+
+	for i, tt := range tests {
+		src, err := Source(tt.node)
+		if err != nil {
+			t.Errorf("tests[%d] - unexpected error: %v", i, err)
+			continue
+		}
+		if src != tt.expected {
+			t.Errorf("tests[%d] - wrong source. expected=%q, got=%q", i, tt.expected, src)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{NewLet("x", nil), "LetStatement.Value is nil"},
+		{NewLet("let", NewInt(1)), `"let" cannot be used as an identifier`},
+		{NewIdent("x1"), `"x1" cannot be used as an identifier`},
+		{NewIdent(""), `"" cannot be used as an identifier`},
+		{NewInfix(NewInt(1), "<>", NewInt(2)), `unknown infix operator "<>"`},
+		{NewPrefix("+", NewInt(1)), `unknown prefix operator "+"`},
+		{NewPostfix(NewInt(1), "++"), "operand of ++ must be an identifier, got IntegerLiteral"},
+		{NewFloat(math.Inf(1)), "float literal +Inf cannot be written in source"},
+		{NewString("\xff"), `string literal "\xff" is not valid UTF-8`},
+		{NewHash(map[Expression]Expression{NewIdent("fn"): NewInt(1)}), `"fn" cannot be used as an identifier`},
+		{&BadExpression{}, "BadExpression is a BadExpression"},
+	}
+
+	for i, tt := range tests {
+		_, err := Source(tt.node)
+		if err == nil {
+			t.Errorf("tests[%d] - expected error %q, got nil", i, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expected, err.Error())
+		}
+	}
+}
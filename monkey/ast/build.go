@@ -0,0 +1,167 @@
+package ast
+
+import (
+	"monkey/token"
+	"strconv"
+)
+
+// ここの関数は、構文解析器を通さずにプログラムを組み立てるためのもの。
+// 構文解析器が作るのと同じようにトークンを埋めるので、組み立てた木はそのまま評価やコンパイルに渡せる。
+// 組み立てた木をソースコードに戻す時は Source を使う
+
+func NewProgram(statements ...Statement) *Program {
+	return &Program{Statements: append([]Statement{}, statements...)}
+}
+
+// let name = value; の文を作る
+func NewLet(name string, value Expression) *LetStatement {
+	return &LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: NewIdent(name), Value: value}
+}
+
+func NewReturn(value Expression) *ReturnStatement {
+	return &ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: value}
+}
+
+func NewExpressionStatement(expression Expression) *ExpressionStatement {
+	return &ExpressionStatement{Token: firstToken(expression), Expression: expression}
+}
+
+func NewBlock(statements ...Statement) *BlockStatement {
+	return &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Statements: append([]Statement{}, statements...)}
+}
+
+// for (init; condition; post) body の文を作る。init, condition, post は省略する時に nil を渡す
+func NewFor(init *LetStatement, condition Expression, post Expression, body *BlockStatement) *ForStatement {
+	stmt := &ForStatement{Token: token.Token{Type: token.FOR, Literal: "for"}, Init: init, Condition: condition, Body: body}
+	if post != nil {
+		stmt.Post = NewExpressionStatement(post)
+	}
+	return stmt
+}
+
+func NewIdent(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func NewInt(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10)}, Value: value}
+}
+
+func NewFloat(value float64) *FloatLiteral {
+	return &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: strconv.FormatFloat(value, 'f', -1, 64)}, Value: value}
+}
+
+// 文字列リテラルを作る。value はエスケープする前の文字列で、Source がソースコードに書く時にエスケープする
+func NewString(value string) *StringLiteral {
+	return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: value}, Value: value}
+}
+
+func NewBool(value bool) *Boolean {
+	if value {
+		return &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+	}
+	return &Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+}
+
+func NewArray(elements ...Expression) *ArrayLiteral {
+	return &ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: append([]Expression{}, elements...)}
+}
+
+func NewHash(pairs map[Expression]Expression) *HashLiteral {
+	hash := &HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Pairs: map[Expression]Expression{}}
+	for key, value := range pairs {
+		hash.Pairs[key] = value
+	}
+	return hash
+}
+
+// left[index] の式を作る
+func NewIndex(left, index Expression) *IndexExpression {
+	return &IndexExpression{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Left: left, Index: index}
+}
+
+// operator は "-", "!", "++", "--" のどれか
+func NewPrefix(operator string, right Expression) *PrefixExpression {
+	return &PrefixExpression{Token: operatorToken(operator), Operator: operator, Right: right}
+}
+
+// operator は "++" か "--"
+func NewPostfix(left Expression, operator string) *PostfixExpression {
+	return &PostfixExpression{Token: operatorToken(operator), Left: left, Operator: operator}
+}
+
+func NewInfix(left Expression, operator string, right Expression) *InfixExpression {
+	return &InfixExpression{Token: operatorToken(operator), Left: left, Operator: operator, Right: right}
+}
+
+func NewFunction(parameters []string, body *BlockStatement) *FunctionLiteral {
+	return &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Parameters: identifiers(parameters), Body: body}
+}
+
+func NewMacro(parameters []string, body *BlockStatement) *MacroLiteral {
+	return &MacroLiteral{Token: token.Token{Type: token.MACRO, Literal: "macro"}, Parameters: identifiers(parameters), Body: body}
+}
+
+func NewCall(function Expression, arguments ...Expression) *CallExpression {
+	return &CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "("}, Function: function, Arguments: append([]Expression{}, arguments...)}
+}
+
+// else がない時は alternative に nil を渡す
+func NewIf(condition Expression, consequence, alternative *BlockStatement) *IfExpression {
+	return &IfExpression{Token: token.Token{Type: token.IF, Literal: "if"}, Condition: condition, Consequence: consequence, Alternative: alternative}
+}
+
+// 演算子のトークンのタイプは演算子の文字列そのもの
+func operatorToken(operator string) token.Token {
+	return token.Token{Type: token.TokenType(operator), Literal: operator}
+}
+
+func identifiers(names []string) []*Identifier {
+	idents := []*Identifier{}
+	for _, name := range names {
+		idents = append(idents, NewIdent(name))
+	}
+	return idents
+}
+
+// 式の最初のトークン。構文解析器は式文のトークンに、式の最初のトークンを使う
+func firstToken(expression Expression) token.Token {
+	switch e := expression.(type) {
+	case *InfixExpression:
+		return firstToken(e.Left)
+	case *PostfixExpression:
+		return firstToken(e.Left)
+	case *IndexExpression:
+		return firstToken(e.Left)
+	case *CallExpression:
+		return firstToken(e.Function)
+	case *Identifier:
+		return e.Token
+	case *IntegerLiteral:
+		return e.Token
+	case *FloatLiteral:
+		return e.Token
+	case *StringLiteral:
+		return e.Token
+	case *Boolean:
+		return e.Token
+	case *ArrayLiteral:
+		return e.Token
+	case *HashLiteral:
+		return e.Token
+	case *PrefixExpression:
+		return e.Token
+	case *FunctionLiteral:
+		return e.Token
+	case *MacroLiteral:
+		return e.Token
+	case *IfExpression:
+		return e.Token
+	case *InlinedCall:
+		return firstToken(e.Body)
+	case *BadExpression:
+		return e.Token
+	default:
+		return token.Token{}
+	}
+}
@@ -0,0 +1,90 @@
+package ast
+
+// 木を深さ優先でたどって、各ノードに f を適用する。f は子ノードよりも先にそのノード自身に適用され、
+// false を返した時はそのノードの子をたどらない。nil の子ノード(省略した else など)はたどらない。
+// Modify と違って木を書き換えないので、解析のように木を読むだけの処理に使う。
+// Modify と違ってマクロリテラルの中もたどる。ハッシュリテラルの組をたどる順序は決まっていない
+func Inspect(node Node, f func(Node) bool) {
+	if IsNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *LetStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Value, f)
+
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *ForStatement:
+		Inspect(node.Init, f)
+		Inspect(node.Condition, f)
+		Inspect(node.Post, f)
+		Inspect(node.Body, f)
+
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			Inspect(e, f)
+		}
+
+	case *HashLiteral:
+		for key, value := range node.Pairs {
+			Inspect(key, f)
+			Inspect(value, f)
+		}
+
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+
+	case *PostfixExpression:
+		Inspect(node.Left, f)
+
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments {
+			Inspect(arg, f)
+		}
+
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		Inspect(node.Alternative, f)
+
+	case *InlinedCall:
+		Inspect(node.Body, f) // Function は評価しないので、たどらない
+	}
+}
@@ -0,0 +1,85 @@
+package ast
+
+// ASTノードの種類を表す整数。
+// 解析や変換で頻繁にノードの種類を調べる時に、型スイッチの代わりに Kind() の値で switch できる
+type NodeKind int
+
+const (
+	KindInvalid NodeKind = iota // ゼロ値。どのノードもこの値を返さない
+
+	KindProgram
+
+	// 文
+	KindLetStatement
+	KindReturnStatement
+	KindExpressionStatement
+	KindBlockStatement
+	KindForStatement
+	KindBadStatement
+
+	// 式
+	KindIdentifier
+	KindIntegerLiteral
+	KindFloatLiteral
+	KindStringLiteral
+	KindBoolean
+	KindArrayLiteral
+	KindHashLiteral
+	KindIndexExpression
+	KindPrefixExpression
+	KindPostfixExpression
+	KindInfixExpression
+	KindFunctionLiteral
+	KindMacroLiteral
+	KindCallExpression
+	KindIfExpression
+	KindInlinedCall
+	KindBadExpression
+
+	numKinds // 種類の数。ノードを追加する時はこの上に追加する
+)
+
+var kindNames = [...]string{
+	KindInvalid:             "Invalid",
+	KindProgram:             "Program",
+	KindLetStatement:        "LetStatement",
+	KindReturnStatement:     "ReturnStatement",
+	KindExpressionStatement: "ExpressionStatement",
+	KindBlockStatement:      "BlockStatement",
+	KindForStatement:        "ForStatement",
+	KindBadStatement:        "BadStatement",
+	KindIdentifier:          "Identifier",
+	KindIntegerLiteral:      "IntegerLiteral",
+	KindFloatLiteral:        "FloatLiteral",
+	KindStringLiteral:       "StringLiteral",
+	KindBoolean:             "Boolean",
+	KindArrayLiteral:        "ArrayLiteral",
+	KindHashLiteral:         "HashLiteral",
+	KindIndexExpression:     "IndexExpression",
+	KindPrefixExpression:    "PrefixExpression",
+	KindPostfixExpression:   "PostfixExpression",
+	KindInfixExpression:     "InfixExpression",
+	KindFunctionLiteral:     "FunctionLiteral",
+	KindMacroLiteral:        "MacroLiteral",
+	KindCallExpression:      "CallExpression",
+	KindIfExpression:        "IfExpression",
+	KindInlinedCall:         "InlinedCall",
+	KindBadExpression:       "BadExpression",
+}
+
+// ノードの型の名前を返す。たとえば KindLetStatement なら "LetStatement"
+func (k NodeKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) || kindNames[k] == "" {
+		return "NodeKind(?)"
+	}
+	return kindNames[k]
+}
+
+// KindInvalid を除いた、すべてのノードの種類を定義順に返す
+func Kinds() []NodeKind {
+	kinds := make([]NodeKind, 0, numKinds-1)
+	for k := KindInvalid + 1; k < numKinds; k++ {
+		kinds = append(kinds, k)
+	}
+	return kinds
+}
@@ -0,0 +1,100 @@
+package ast
+
+// Modify が木の各ノードに適用する関数。置き換えるノードを返す。置き換えない時は受け取ったノードをそのまま返す
+type ModifierFunc func(Node) Node
+
+// 木を深さ優先でたどって、子ノードを先に書き換えてから、そのノード自身に modifier を適用する。
+// 子のノードはその場で書き換えるので、渡した木そのものが変更される。
+// マクロリテラルの中はマクロが呼び出されるまで書き換えてはいけないので、たどらない
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+
+	case *Program:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+
+	case *LetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+
+	case *BlockStatement:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+
+	case *ForStatement:
+		// 初期化と後処理は文なので、式に置き換えられてしまった時は元のままにしておく
+		if node.Init != nil {
+			if init, ok := Modify(node.Init, modifier).(*LetStatement); ok {
+				node.Init = init
+			}
+		}
+		if node.Condition != nil {
+			node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		}
+		if node.Post != nil {
+			if post, ok := Modify(node.Post, modifier).(*ExpressionStatement); ok {
+				node.Post = post
+			}
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *PostfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+
+	case *FunctionLiteral:
+		for i := range node.Parameters {
+			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i], _ = Modify(element, modifier).(Expression)
+		}
+
+	case *HashLiteral:
+		newPairs := make(map[Expression]Expression)
+		for key, value := range node.Pairs {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newValue, _ := Modify(value, modifier).(Expression)
+			newPairs[newKey] = newValue
+		}
+		node.Pairs = newPairs
+
+	case *InlinedCall:
+		node.Body, _ = Modify(node.Body, modifier).(Expression)
+	}
+
+	return modifier(node)
+}
@@ -0,0 +1,326 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"monkey/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// node を、構文解析すると同じ木になる Monkey のソースコードにして返す。
+// String() は木を確かめるための表示で、そのままでは構文解析できないことがある(文字列の '"' がないなど)。
+// 式はすべて括弧で囲むので、優先順位を気にせずに木を組み立てられる。ただし負の数のリテラルは、
+// 前置演算子の "-" と正の数のリテラルの式として書くので、構文解析した木では PrefixExpression になる。
+// Validate で見つかる問題のほかに、識別子として使えない名前、知らない演算子、ソースコードに書けない値がある時はエラーを返す
+func Source(node Node) (string, error) {
+	if err := Validate(node); err != nil {
+		return "", err
+	}
+
+	p := &printer{}
+	p.node(node)
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.out.String(), nil
+}
+
+var (
+	prefixOperators  = map[string]bool{"-": true, "!": true, "++": true, "--": true}
+	postfixOperators = map[string]bool{"++": true, "--": true}
+	infixOperators   = map[string]bool{
+		"||": true, "&&": true, "==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+		"+": true, "-": true, "*": true, "/": true, "%": true, "**": true,
+	}
+)
+
+// 最初のエラーを覚えておいて、それ以降は書き出さない
+type printer struct {
+	out strings.Builder
+	err error
+}
+
+func (p *printer) write(s string) {
+	if p.err == nil {
+		p.out.WriteString(s)
+	}
+}
+
+func (p *printer) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *printer) node(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for i, s := range node.Statements {
+			if i > 0 {
+				p.write("\n")
+			}
+			p.node(s)
+		}
+
+	case *LetStatement:
+		p.write("let ")
+		p.node(node.Name)
+		p.write(" = ")
+		p.node(node.Value)
+		p.write(";")
+
+	case *ReturnStatement:
+		p.write("return ")
+		p.node(node.ReturnValue)
+		p.write(";")
+
+	case *ExpressionStatement:
+		p.node(node.Expression)
+		p.write(";")
+
+	case *BlockStatement:
+		if len(node.Statements) == 0 {
+			p.write("{}")
+			return
+		}
+		p.write("{ ")
+		for _, s := range node.Statements {
+			p.node(s)
+			p.write(" ")
+		}
+		p.write("}")
+
+	case *ForStatement:
+		// for 文の後ろに ';' を書くと空の文になって構文解析できないので、';' はつけない
+		p.write("for (")
+		if node.Init != nil {
+			p.node(node.Init) // let 文は ';' で終わる
+		} else {
+			p.write(";")
+		}
+		if node.Condition != nil {
+			p.write(" ")
+			p.node(node.Condition)
+		}
+		p.write(";")
+		if node.Post != nil {
+			p.write(" ")
+			p.node(node.Post.Expression)
+		}
+		p.write(") ")
+		p.node(node.Body)
+
+	case *Identifier:
+		if !isIdentifier(node.Value) {
+			p.fail("%q cannot be used as an identifier", node.Value)
+		}
+		p.write(node.Value)
+
+	case *IntegerLiteral:
+		switch {
+		case node.Value == math.MinInt64: // 符号を取った値が int64 に収まらない
+			p.write(fmt.Sprintf("(-%d - 1)", int64(math.MaxInt64)))
+		case node.Value < 0:
+			p.write(fmt.Sprintf("(-%d)", -node.Value))
+		default:
+			p.write(strconv.FormatInt(node.Value, 10))
+		}
+
+	case *FloatLiteral:
+		if math.IsNaN(node.Value) || math.IsInf(node.Value, 0) {
+			p.fail("float literal %v cannot be written in source", node.Value)
+			return
+		}
+		s := strconv.FormatFloat(math.Abs(node.Value), 'f', -1, 64)
+		if !strings.Contains(s, ".") { // 字句解析器は '.' のない数を整数にする
+			s += ".0"
+		}
+		if math.Signbit(node.Value) {
+			s = "(-" + s + ")"
+		}
+		p.write(s)
+
+	case *StringLiteral:
+		p.write(p.quote(node.Value))
+
+	case *Boolean:
+		p.write(strconv.FormatBool(node.Value))
+
+	case *ArrayLiteral:
+		p.write("[")
+		p.expressions(node.Elements)
+		p.write("]")
+
+	case *HashLiteral:
+		p.hash(node)
+
+	case *IndexExpression:
+		p.write("(")
+		p.node(node.Left)
+		p.write("[")
+		p.node(node.Index)
+		p.write("])")
+
+	case *PrefixExpression:
+		if !prefixOperators[node.Operator] {
+			p.fail("unknown prefix operator %q", node.Operator)
+		}
+		p.updateOperand(node.Operator, node.Right)
+		p.write("(" + node.Operator)
+		p.node(node.Right)
+		p.write(")")
+
+	case *PostfixExpression:
+		if !postfixOperators[node.Operator] {
+			p.fail("unknown postfix operator %q", node.Operator)
+		}
+		p.updateOperand(node.Operator, node.Left)
+		p.write("(")
+		p.node(node.Left)
+		p.write(node.Operator + ")")
+
+	case *InfixExpression:
+		if !infixOperators[node.Operator] {
+			p.fail("unknown infix operator %q", node.Operator)
+		}
+		p.write("(")
+		p.node(node.Left)
+		p.write(" " + node.Operator + " ")
+		p.node(node.Right)
+		p.write(")")
+
+	case *FunctionLiteral:
+		p.write("fn(")
+		p.parameters(node.Parameters)
+		p.write(") ")
+		p.node(node.Body)
+
+	case *MacroLiteral:
+		p.write("macro(")
+		p.parameters(node.Parameters)
+		p.write(") ")
+		p.node(node.Body)
+
+	case *CallExpression:
+		if _, ok := node.Function.(*Identifier); ok {
+			p.node(node.Function)
+		} else {
+			p.write("(")
+			p.node(node.Function)
+			p.write(")")
+		}
+		p.write("(")
+		p.expressions(node.Arguments)
+		p.write(")")
+
+	case *IfExpression:
+		p.write("if (")
+		p.node(node.Condition)
+		p.write(") ")
+		p.node(node.Consequence)
+		if node.Alternative != nil {
+			p.write(" else ")
+			p.node(node.Alternative)
+		}
+
+	case *InlinedCall:
+		p.node(node.Body) // 構文解析すると呼び出しの記録はなくなるが、値は同じになる
+
+	default:
+		p.fail("cannot write %s as source", node.Kind())
+	}
+}
+
+func (p *printer) expressions(expressions []Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.node(e)
+	}
+}
+
+func (p *printer) parameters(parameters []*Identifier) {
+	for i, param := range parameters {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.node(param)
+	}
+}
+
+// ハッシュの組の順序は決まっていないので、同じ木からいつも同じソースコードができるように、キーのソースコードの順に並べる
+func (p *printer) hash(node *HashLiteral) {
+	pairs := []string{}
+	for key, value := range node.Pairs {
+		k := &printer{}
+		k.node(key)
+		v := &printer{}
+		v.node(value)
+		for _, sub := range []*printer{k, v} {
+			if p.err == nil {
+				p.err = sub.err
+			}
+		}
+		pairs = append(pairs, k.out.String()+": "+v.out.String())
+	}
+	sort.Strings(pairs)
+
+	p.write("{" + strings.Join(pairs, ", ") + "}")
+}
+
+// 構文解析器は ++ と -- の被演算子に識別子しか認めない
+func (p *printer) updateOperand(operator string, operand Expression) {
+	if operator != "++" && operator != "--" {
+		return
+	}
+	if _, ok := operand.(*Identifier); !ok {
+		p.fail("operand of %s must be an identifier, got %s", operator, operand.Kind())
+	}
+}
+
+// 字句解析器が読めるエスケープシーケンスだけを使って、文字列を '"' で囲む
+func (p *printer) quote(s string) string {
+	if !utf8.ValidString(s) {
+		p.fail("string literal %q is not valid UTF-8", s)
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, ch := range s {
+		switch {
+		case ch == '"':
+			out.WriteString(`\"`)
+		case ch == '\\':
+			out.WriteString(`\\`)
+		case ch == '\n':
+			out.WriteString(`\n`)
+		case ch == '\t':
+			out.WriteString(`\t`)
+		case !unicode.IsPrint(ch):
+			fmt.Fprintf(&out, `\u{%X}`, ch)
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// 字句解析器が一つの識別子として読む名前かどうか。キーワードは識別子にならない
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for _, ch := range name {
+		if !unicode.IsLetter(ch) && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
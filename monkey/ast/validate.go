@@ -0,0 +1,230 @@
+package ast
+
+import (
+	"fmt"
+	"monkey/token"
+)
+
+// 構文解析器が作った木が満たしているはずの性質を確かめて、最初に見つかった違反を返す。問題がなければ nil を返す。
+// 確かめるのは、省略できない子ノードが nil でないこと(nil のポインタを入れたインターフェースも含む)と BadExpression などがないこと、
+// 演算子の文字列がトークンのタイプと一致していること。構文解析がエラーなしで終わった木だけが対象になる
+func Validate(node Node) error {
+	if IsNil(node) {
+		return fmt.Errorf("node is nil")
+	}
+	return validate(node, node.Kind().String())
+}
+
+// path はエラーメッセージでノードの場所を示すための、根からのフィールドのたどり方
+func validate(node Node, path string) error {
+	if IsNil(node) {
+		return fmt.Errorf("%s is nil", path)
+	}
+
+	switch node := node.(type) {
+	case *BadExpression, *BadStatement:
+		return fmt.Errorf("%s is a %s", path, node.Kind())
+
+	case *Program:
+		for i, s := range node.Statements {
+			if err := validate(s, fmt.Sprintf("%s.Statements[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case *LetStatement:
+		if err := validate(node.Name, path+".Name"); err != nil {
+			return err
+		}
+		return validate(node.Value, path+".Value")
+
+	case *ReturnStatement:
+		return validate(node.ReturnValue, path+".ReturnValue")
+
+	case *ExpressionStatement:
+		return validate(node.Expression, path+".Expression")
+
+	case *BlockStatement:
+		for i, s := range node.Statements {
+			if err := validate(s, fmt.Sprintf("%s.Statements[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case *ForStatement:
+		// 初期化、条件、後処理は省略できるので、ある時だけ確かめる
+		if node.Init != nil {
+			if err := validate(node.Init, path+".Init"); err != nil {
+				return err
+			}
+		}
+		if node.Condition != nil {
+			if err := validate(node.Condition, path+".Condition"); err != nil {
+				return err
+			}
+		}
+		if node.Post != nil {
+			if err := validate(node.Post, path+".Post"); err != nil {
+				return err
+			}
+		}
+		return validate(node.Body, path+".Body")
+
+	case *ArrayLiteral:
+		for i, e := range node.Elements {
+			if err := validate(e, fmt.Sprintf("%s.Elements[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case *HashLiteral:
+		for key, value := range node.Pairs {
+			if err := validate(key, path+".Pairs key"); err != nil {
+				return err
+			}
+			if err := validate(value, path+".Pairs value"); err != nil {
+				return err
+			}
+		}
+
+	case *IndexExpression:
+		if err := validate(node.Left, path+".Left"); err != nil {
+			return err
+		}
+		return validate(node.Index, path+".Index")
+
+	case *PrefixExpression:
+		if err := validateOperator(node.Operator, node.Token.Type, path); err != nil {
+			return err
+		}
+		return validate(node.Right, path+".Right")
+
+	case *PostfixExpression:
+		if err := validateOperator(node.Operator, node.Token.Type, path); err != nil {
+			return err
+		}
+		return validate(node.Left, path+".Left")
+
+	case *InfixExpression:
+		if err := validateOperator(node.Operator, node.Token.Type, path); err != nil {
+			return err
+		}
+		if err := validate(node.Left, path+".Left"); err != nil {
+			return err
+		}
+		return validate(node.Right, path+".Right")
+
+	case *FunctionLiteral:
+		for i, p := range node.Parameters {
+			if err := validate(p, fmt.Sprintf("%s.Parameters[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return validate(node.Body, path+".Body")
+
+	case *MacroLiteral:
+		for i, p := range node.Parameters {
+			if err := validate(p, fmt.Sprintf("%s.Parameters[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return validate(node.Body, path+".Body")
+
+	case *CallExpression:
+		if err := validate(node.Function, path+".Function"); err != nil {
+			return err
+		}
+		for i, a := range node.Arguments {
+			if err := validate(a, fmt.Sprintf("%s.Arguments[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case *IfExpression:
+		if err := validate(node.Condition, path+".Condition"); err != nil {
+			return err
+		}
+		if err := validate(node.Consequence, path+".Consequence"); err != nil {
+			return err
+		}
+		if node.Alternative != nil {
+			return validate(node.Alternative, path+".Alternative")
+		}
+
+	case *InlinedCall:
+		if err := validate(node.Function, path+".Function"); err != nil {
+			return err
+		}
+		return validate(node.Body, path+".Body")
+	}
+
+	return nil
+}
+
+// 演算子のトークンのタイプは演算子の文字列そのものなので(token.PLUS は "+")、両者は一致していなければならない
+func validateOperator(operator string, tokenType token.TokenType, path string) error {
+	if operator != string(tokenType) {
+		return fmt.Errorf("%s.Operator is %q, but its token type is %s", path, operator, tokenType)
+	}
+	return nil
+}
+
+// ノードが nil かどうか。ノードはすべてポインタなので、nil のポインタを入れたインターフェースも nil として扱う。
+// Inspect がすべてのノードで呼ぶので、reflect は使わずに種類ごとの型で nil を比べる
+// (Kind() はレシーバを参照しないので、nil のポインタでも呼べる)
+func IsNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	switch node.Kind() {
+	case KindProgram:
+		return node.(*Program) == nil
+	case KindLetStatement:
+		return node.(*LetStatement) == nil
+	case KindReturnStatement:
+		return node.(*ReturnStatement) == nil
+	case KindExpressionStatement:
+		return node.(*ExpressionStatement) == nil
+	case KindBlockStatement:
+		return node.(*BlockStatement) == nil
+	case KindForStatement:
+		return node.(*ForStatement) == nil
+	case KindBadStatement:
+		return node.(*BadStatement) == nil
+	case KindIdentifier:
+		return node.(*Identifier) == nil
+	case KindIntegerLiteral:
+		return node.(*IntegerLiteral) == nil
+	case KindFloatLiteral:
+		return node.(*FloatLiteral) == nil
+	case KindStringLiteral:
+		return node.(*StringLiteral) == nil
+	case KindBoolean:
+		return node.(*Boolean) == nil
+	case KindArrayLiteral:
+		return node.(*ArrayLiteral) == nil
+	case KindHashLiteral:
+		return node.(*HashLiteral) == nil
+	case KindIndexExpression:
+		return node.(*IndexExpression) == nil
+	case KindPrefixExpression:
+		return node.(*PrefixExpression) == nil
+	case KindPostfixExpression:
+		return node.(*PostfixExpression) == nil
+	case KindInfixExpression:
+		return node.(*InfixExpression) == nil
+	case KindFunctionLiteral:
+		return node.(*FunctionLiteral) == nil
+	case KindMacroLiteral:
+		return node.(*MacroLiteral) == nil
+	case KindCallExpression:
+		return node.(*CallExpression) == nil
+	case KindIfExpression:
+		return node.(*IfExpression) == nil
+	case KindInlinedCall:
+		return node.(*InlinedCall) == nil
+	case KindBadExpression:
+		return node.(*BadExpression) == nil
+	}
+	return false
+}
@@ -0,0 +1,519 @@
+// 構文木と JSON の変換。外部のツールが構文解析した木を保存したり、調べたり、比べたり、組み立て直したりするために使う。
+//
+// ノードは "kind" にノードの種類(ast.NodeKind の名前)を持つオブジェクトになり、"token" にトークンを、
+// 残りのフィールドに子ノードや値を持つ。フィールドの名前は ast のフィールドの名前の先頭を小文字にしたもの。
+// ただし識別子とリテラルの値は、ノードの種類ごとに "ident"、"int"、"float"、"string"、"bool" に入れる。
+// たとえば 1 + x は次のようになる(トークンの位置は省略している)。
+//
+//	{"kind": "InfixExpression", "token": {"type": "+", "literal": "+"}, "operator": "+",
+//	 "left": {"kind": "IntegerLiteral", "token": {"type": "INT", "literal": "1"}, "int": 1},
+//	 "right": {"kind": "Identifier", "token": {"type": "IDENT", "literal": "x"}, "ident": "x"}}
+package astjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+// 一つのノードの JSON の形。ノードの種類ごとに、使うフィールドだけを書き出す
+type jsonNode struct {
+	Kind  string     `json:"kind"`
+	Token *jsonToken `json:"token,omitempty"`
+
+	Operator string `json:"operator,omitempty"`
+	Error    string `json:"error,omitempty"` // BadExpression と BadStatement の構文解析のエラー
+
+	Ident  *string  `json:"ident,omitempty"`  // Identifier の名前
+	Int    *int64   `json:"int,omitempty"`    // IntegerLiteral の値
+	Float  *float64 `json:"float,omitempty"`  // FloatLiteral の値
+	String *string  `json:"string,omitempty"` // StringLiteral の値
+	Bool   *bool    `json:"bool,omitempty"`   // Boolean の値
+
+	Value       *jsonNode   `json:"value,omitempty"` // LetStatement の束縛する式
+	Name        *jsonNode   `json:"name,omitempty"`
+	ReturnValue *jsonNode   `json:"returnValue,omitempty"`
+	Expression  *jsonNode   `json:"expression,omitempty"`
+	Statements  []*jsonNode `json:"statements,omitempty"`
+	Init        *jsonNode   `json:"init,omitempty"`
+	Condition   *jsonNode   `json:"condition,omitempty"`
+	Post        *jsonNode   `json:"post,omitempty"`
+	Body        *jsonNode   `json:"body,omitempty"`
+	Elements    []*jsonNode `json:"elements,omitempty"`
+	Pairs       []jsonPair  `json:"pairs,omitempty"`
+	Left        *jsonNode   `json:"left,omitempty"`
+	Index       *jsonNode   `json:"index,omitempty"`
+	Right       *jsonNode   `json:"right,omitempty"`
+	Parameters  []*jsonNode `json:"parameters,omitempty"`
+	Function    *jsonNode   `json:"function,omitempty"`
+	Arguments   []*jsonNode `json:"arguments,omitempty"`
+	Consequence *jsonNode   `json:"consequence,omitempty"`
+	Alternative *jsonNode   `json:"alternative,omitempty"`
+}
+
+type jsonToken struct {
+	Type    string `json:"type"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// HashLiteral の組
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// node を JSON にする。nil の子ノードは書き出さない。
+// ハッシュリテラルの組は、同じ木からいつも同じ JSON ができるように、キーの String() の順に並べる
+func Marshal(node ast.Node) ([]byte, error) {
+	j, err := encode(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// Marshal で書き出した JSON から木を組み立て直す。組み立てた木は ast.Validate で確かめて、問題があればエラーを返す。
+// そのため BadExpression や BadStatement を含む木(構文解析に失敗した木)は、書き出せても組み立て直せない
+func Unmarshal(data []byte) (ast.Node, error) {
+	var j *jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j == nil {
+		return nil, errors.New("astjson: no node")
+	}
+	node, err := decode(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := ast.Validate(node); err != nil {
+		return nil, fmt.Errorf("astjson: %w", err)
+	}
+	return node, nil
+}
+
+func encode(node ast.Node) (*jsonNode, error) {
+	if ast.IsNil(node) {
+		return nil, nil
+	}
+
+	j := &jsonNode{Kind: node.Kind().String()}
+	var err error
+	// 子ノードを順に書き出す。最初のエラーを err に残して、それ以降は何もしない
+	child := func(n ast.Node) *jsonNode {
+		if err != nil {
+			return nil
+		}
+		var c *jsonNode
+		c, err = encode(n)
+		return c
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		j.Statements = statements(node.Statements, child)
+
+	case *ast.LetStatement:
+		j.Token = encodeToken(node.Token)
+		j.Name = child(node.Name)
+		j.Value = child(node.Value)
+
+	case *ast.ReturnStatement:
+		j.Token = encodeToken(node.Token)
+		j.ReturnValue = child(node.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		j.Token = encodeToken(node.Token)
+		j.Expression = child(node.Expression)
+
+	case *ast.BlockStatement:
+		j.Token = encodeToken(node.Token)
+		j.Statements = statements(node.Statements, child)
+
+	case *ast.ForStatement:
+		j.Token = encodeToken(node.Token)
+		j.Init = child(node.Init)
+		j.Condition = child(node.Condition)
+		j.Post = child(node.Post)
+		j.Body = child(node.Body)
+
+	case *ast.BadStatement:
+		j.Token = encodeToken(node.Token)
+		j.Error = errorMessage(node.Err)
+
+	case *ast.Identifier:
+		j.Token = encodeToken(node.Token)
+		j.Ident = &node.Value
+
+	case *ast.IntegerLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Int = &node.Value
+
+	case *ast.FloatLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Float = &node.Value // NaN と無限大は JSON にできないので、Marshal がエラーになる
+
+	case *ast.StringLiteral:
+		j.Token = encodeToken(node.Token)
+		j.String = &node.Value
+
+	case *ast.Boolean:
+		j.Token = encodeToken(node.Token)
+		j.Bool = &node.Value
+
+	case *ast.ArrayLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Elements = expressions(node.Elements, child)
+
+	case *ast.HashLiteral:
+		j.Token = encodeToken(node.Token)
+		keys := []ast.Expression{}
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.SliceStable(keys, func(a, b int) bool { return keyString(keys[a]) < keyString(keys[b]) })
+		j.Pairs = []jsonPair{}
+		for _, key := range keys {
+			j.Pairs = append(j.Pairs, jsonPair{Key: child(key), Value: child(node.Pairs[key])})
+		}
+
+	case *ast.IndexExpression:
+		j.Token = encodeToken(node.Token)
+		j.Left = child(node.Left)
+		j.Index = child(node.Index)
+
+	case *ast.PrefixExpression:
+		j.Token = encodeToken(node.Token)
+		j.Operator = node.Operator
+		j.Right = child(node.Right)
+
+	case *ast.PostfixExpression:
+		j.Token = encodeToken(node.Token)
+		j.Operator = node.Operator
+		j.Left = child(node.Left)
+
+	case *ast.InfixExpression:
+		j.Token = encodeToken(node.Token)
+		j.Operator = node.Operator
+		j.Left = child(node.Left)
+		j.Right = child(node.Right)
+
+	case *ast.FunctionLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Parameters = identifiers(node.Parameters, child)
+		j.Body = child(node.Body)
+
+	case *ast.MacroLiteral:
+		j.Token = encodeToken(node.Token)
+		j.Parameters = identifiers(node.Parameters, child)
+		j.Body = child(node.Body)
+
+	case *ast.CallExpression:
+		j.Token = encodeToken(node.Token)
+		j.Function = child(node.Function)
+		j.Arguments = expressions(node.Arguments, child)
+
+	case *ast.IfExpression:
+		j.Token = encodeToken(node.Token)
+		j.Condition = child(node.Condition)
+		j.Consequence = child(node.Consequence)
+		j.Alternative = child(node.Alternative)
+
+	case *ast.InlinedCall:
+		j.Token = encodeToken(node.Token)
+		j.Function = child(node.Function)
+		j.Body = child(node.Body)
+
+	case *ast.BadExpression:
+		j.Token = encodeToken(node.Token)
+		j.Error = errorMessage(node.Err)
+
+	default:
+		return nil, fmt.Errorf("astjson: unsupported node %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func statements(stmts []ast.Statement, child func(ast.Node) *jsonNode) []*jsonNode {
+	nodes := []*jsonNode{}
+	for _, s := range stmts {
+		nodes = append(nodes, child(s))
+	}
+	return nodes
+}
+
+func expressions(exprs []ast.Expression, child func(ast.Node) *jsonNode) []*jsonNode {
+	nodes := []*jsonNode{}
+	for _, e := range exprs {
+		nodes = append(nodes, child(e))
+	}
+	return nodes
+}
+
+func identifiers(idents []*ast.Identifier, child func(ast.Node) *jsonNode) []*jsonNode {
+	nodes := []*jsonNode{}
+	for _, i := range idents {
+		nodes = append(nodes, child(i))
+	}
+	return nodes
+}
+
+func encodeToken(t token.Token) *jsonToken {
+	return &jsonToken{Type: string(t.Type), Literal: t.Literal, Line: t.Line, Column: t.Column}
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func keyString(key ast.Expression) string {
+	if ast.IsNil(key) {
+		return ""
+	}
+	return key.String()
+}
+
+// ノードの種類の名前から NodeKind を引く表
+var kindsByName = func() map[string]ast.NodeKind {
+	kinds := map[string]ast.NodeKind{}
+	for _, k := range ast.Kinds() {
+		kinds[k.String()] = k
+	}
+	return kinds
+}()
+
+func decode(j *jsonNode) (ast.Node, error) {
+	kind, ok := kindsByName[j.Kind]
+	if !ok {
+		return nil, fmt.Errorf("astjson: unknown node kind %q", j.Kind)
+	}
+
+	d := &decoder{}
+	t := decodeToken(j.Token)
+	var node ast.Node
+
+	switch kind {
+	case ast.KindProgram:
+		node = &ast.Program{Statements: d.statements(j.Statements)}
+
+	case ast.KindLetStatement:
+		node = &ast.LetStatement{Token: t, Name: d.identifier(j.Name), Value: d.expression(j.Value)}
+
+	case ast.KindReturnStatement:
+		node = &ast.ReturnStatement{Token: t, ReturnValue: d.expression(j.ReturnValue)}
+
+	case ast.KindExpressionStatement:
+		node = &ast.ExpressionStatement{Token: t, Expression: d.expression(j.Expression)}
+
+	case ast.KindBlockStatement:
+		node = &ast.BlockStatement{Token: t, Statements: d.statements(j.Statements)}
+
+	case ast.KindForStatement:
+		stmt := &ast.ForStatement{Token: t, Condition: d.expression(j.Condition), Body: d.block(j.Body)}
+		if j.Init != nil {
+			stmt.Init, _ = d.node(j.Init).(*ast.LetStatement)
+			d.check(stmt.Init != nil, "init of ForStatement must be a LetStatement")
+		}
+		if j.Post != nil {
+			stmt.Post, _ = d.node(j.Post).(*ast.ExpressionStatement)
+			d.check(stmt.Post != nil, "post of ForStatement must be an ExpressionStatement")
+		}
+		node = stmt
+
+	case ast.KindBadStatement:
+		node = &ast.BadStatement{Token: t, Err: decodeError(j.Error)}
+
+	case ast.KindIdentifier:
+		d.check(j.Ident != nil, "Identifier has no ident")
+		if j.Ident != nil {
+			node = &ast.Identifier{Token: t, Value: *j.Ident}
+		}
+
+	case ast.KindIntegerLiteral:
+		d.check(j.Int != nil, "IntegerLiteral has no int")
+		if j.Int != nil {
+			node = &ast.IntegerLiteral{Token: t, Value: *j.Int}
+		}
+
+	case ast.KindFloatLiteral:
+		d.check(j.Float != nil, "FloatLiteral has no float")
+		if j.Float != nil {
+			node = &ast.FloatLiteral{Token: t, Value: *j.Float}
+		}
+
+	case ast.KindStringLiteral:
+		d.check(j.String != nil, "StringLiteral has no string")
+		if j.String != nil {
+			node = &ast.StringLiteral{Token: t, Value: *j.String}
+		}
+
+	case ast.KindBoolean:
+		d.check(j.Bool != nil, "Boolean has no bool")
+		if j.Bool != nil {
+			node = &ast.Boolean{Token: t, Value: *j.Bool}
+		}
+
+	case ast.KindArrayLiteral:
+		node = &ast.ArrayLiteral{Token: t, Elements: d.expressions(j.Elements)}
+
+	case ast.KindHashLiteral:
+		hash := &ast.HashLiteral{Token: t, Pairs: map[ast.Expression]ast.Expression{}}
+		for _, pair := range j.Pairs {
+			hash.Pairs[d.expression(pair.Key)] = d.expression(pair.Value)
+		}
+		node = hash
+
+	case ast.KindIndexExpression:
+		node = &ast.IndexExpression{Token: t, Left: d.expression(j.Left), Index: d.expression(j.Index)}
+
+	case ast.KindPrefixExpression:
+		node = &ast.PrefixExpression{Token: t, Operator: j.Operator, Right: d.expression(j.Right)}
+
+	case ast.KindPostfixExpression:
+		node = &ast.PostfixExpression{Token: t, Left: d.expression(j.Left), Operator: j.Operator}
+
+	case ast.KindInfixExpression:
+		node = &ast.InfixExpression{Token: t, Left: d.expression(j.Left), Operator: j.Operator, Right: d.expression(j.Right)}
+
+	case ast.KindFunctionLiteral:
+		node = &ast.FunctionLiteral{Token: t, Parameters: d.identifiers(j.Parameters), Body: d.block(j.Body)}
+
+	case ast.KindMacroLiteral:
+		node = &ast.MacroLiteral{Token: t, Parameters: d.identifiers(j.Parameters), Body: d.block(j.Body)}
+
+	case ast.KindCallExpression:
+		node = &ast.CallExpression{Token: t, Function: d.expression(j.Function), Arguments: d.expressions(j.Arguments)}
+
+	case ast.KindIfExpression:
+		node = &ast.IfExpression{Token: t, Condition: d.expression(j.Condition), Consequence: d.block(j.Consequence), Alternative: d.block(j.Alternative)}
+
+	case ast.KindInlinedCall:
+		node = &ast.InlinedCall{Token: t, Function: d.identifier(j.Function), Body: d.expression(j.Body)}
+
+	case ast.KindBadExpression:
+		node = &ast.BadExpression{Token: t, Err: decodeError(j.Error)}
+
+	default:
+		return nil, fmt.Errorf("astjson: unsupported node kind %s", kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// 子ノードを順に組み立てる。最初のエラーを err に残して、それ以降は nil を返す
+type decoder struct {
+	err error
+}
+
+func (d *decoder) node(j *jsonNode) ast.Node {
+	if d.err != nil || j == nil {
+		return nil
+	}
+	node, err := decode(j)
+	if err != nil {
+		d.err = err
+		return nil
+	}
+	return node
+}
+
+func (d *decoder) check(ok bool, msg string) {
+	if !ok && d.err == nil {
+		d.err = errors.New("astjson: " + msg)
+	}
+}
+
+// j がない時は nil のインターフェースを返す。nil のポインタを入れた ast.Expression にしない
+func (d *decoder) expression(j *jsonNode) ast.Expression {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	expr, ok := node.(ast.Expression)
+	d.check(ok, node.Kind().String()+" is not an expression")
+	return expr
+}
+
+func (d *decoder) statement(j *jsonNode) ast.Statement {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	stmt, ok := node.(ast.Statement)
+	d.check(ok, node.Kind().String()+" is not a statement")
+	return stmt
+}
+
+func (d *decoder) identifier(j *jsonNode) *ast.Identifier {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*ast.Identifier)
+	d.check(ok, "expected Identifier, got "+node.Kind().String())
+	return ident
+}
+
+func (d *decoder) block(j *jsonNode) *ast.BlockStatement {
+	node := d.node(j)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*ast.BlockStatement)
+	d.check(ok, "expected BlockStatement, got "+node.Kind().String())
+	return block
+}
+
+// 構文解析器は空のリストにも nil ではないスライスを作るので、それに合わせる
+func (d *decoder) statements(js []*jsonNode) []ast.Statement {
+	stmts := []ast.Statement{}
+	for _, j := range js {
+		stmts = append(stmts, d.statement(j))
+	}
+	return stmts
+}
+
+func (d *decoder) expressions(js []*jsonNode) []ast.Expression {
+	exprs := []ast.Expression{}
+	for _, j := range js {
+		exprs = append(exprs, d.expression(j))
+	}
+	return exprs
+}
+
+func (d *decoder) identifiers(js []*jsonNode) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+	for _, j := range js {
+		idents = append(idents, d.identifier(j))
+	}
+	return idents
+}
+
+func decodeToken(j *jsonToken) token.Token {
+	if j == nil {
+		return token.Token{}
+	}
+	return token.Token{Type: token.TokenType(j.Type), Literal: j.Literal, Line: j.Line, Column: j.Column}
+}
+
+func decodeError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
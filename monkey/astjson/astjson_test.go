@@ -0,0 +1,148 @@
+package astjson
+
+import (
+	"math"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 5; let y = x * 2 + 1; return y;",
+		"-a * b ** 2 % 4 - !true + 1.5",
+		`let add = fn(a, b) { a + b }; add(1, add(2, "three"));`,
+		"if (x < y) { x } else { y }; if (x) { 1 }",
+		"[1, 2, [3]][1 + 1]",
+		"for (let i = 0; i < 10; i++) { puts(i); --i } for (;;) {}",
+		"let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) };",
+		"fn() {}()",
+		"",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+
+		data, err := Marshal(program)
+		if err != nil {
+			t.Fatalf("Marshal(%q) returned error: %v", input, err)
+		}
+		node, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal returned error for %q: %v\njson=%s", input, err, data)
+		}
+
+		if !reflect.DeepEqual(node, program) {
+			t.Errorf("tree changed after round trip of %q.\nexpected=%#v\ngot=%#v", input, program, node)
+		}
+	}
+}
+
+// ハッシュのキーはポインタなので DeepEqual では比べられない。String() と、同じ JSON になることを確かめる
+func TestRoundTripHashLiteral(t *testing.T) {
+	program := parse(t, `{"one": 1, "two": 2, true: fn(x) { x }}`)
+
+	data, err := Marshal(program)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	node, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+
+	again, err := Marshal(node)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("json changed after round trip.\nexpected=%s\ngot=%s", data, again)
+	}
+
+	hash := node.(*ast.Program).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := Marshal(ast.NewInfix(ast.NewInt(1), "+", ast.NewIdent("x")))
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+
+	expected := `{"kind":"InfixExpression","token":{"type":"+","literal":"+"},"operator":"+",` +
+		`"left":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"1"},"int":1},` +
+		`"right":{"kind":"Identifier","token":{"type":"IDENT","literal":"x"},"ident":"x"}}`
+	if string(data) != expected {
+		t.Errorf("wrong json.\nexpected=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestBadNodes(t *testing.T) {
+	p := parser.New(lexer.New("let x = ;"))
+	program := p.ParseProgram()
+
+	// 構文解析に失敗した木も書き出せるが、Validate を通らないので組み立て直せない
+	data, err := Marshal(program)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	expected := `"error":"` + p.ErrorList()[0].Error() + `"`
+	if !strings.Contains(string(data), expected) {
+		t.Errorf("json does not contain the parse error %s.\njson=%s", expected, data)
+	}
+
+	_, err = Unmarshal(data)
+	if err == nil || err.Error() != "astjson: Program.Statements[0].Value is a BadExpression" {
+		t.Errorf("wrong error from Unmarshal. got=%v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Marshal(ast.NewFloat(math.NaN())); err == nil {
+		t.Errorf("Marshal accepted NaN")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "WhileStatement"}`, `astjson: unknown node kind "WhileStatement"`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "ident": "x"}]}`, "astjson: Identifier is not a statement"},
+		{`{"kind": "FunctionLiteral", "parameters": [{"kind": "IntegerLiteral", "int": 1}]}`, "astjson: expected Identifier, got IntegerLiteral"},
+		{`{"kind": "IntegerLiteral", "int": "one"}`, "json: cannot unmarshal string into Go struct field .int of type int64"},
+		// 種類に合わないフィールドの値は使わない
+		{`{"kind": "IntegerLiteral", "ident": "one"}`, "astjson: IntegerLiteral has no int"},
+		{`{"kind": "Boolean", "int": 1}`, "astjson: Boolean has no bool"},
+		// 組み立てた木は Validate で確かめる
+		{`{"kind": "LetStatement", "name": {"kind": "Identifier", "ident": "x"}}`, "astjson: LetStatement.Value is nil"},
+		{`{"kind": "PrefixExpression", "token": {"type": "!", "literal": "!"}, "operator": "-", "right": {"kind": "Boolean", "bool": true}}`,
+			`astjson: PrefixExpression.Operator is "-", but its token type is !`},
+		{`null`, "astjson: no node"},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error %q for %s, got nil", tt.expected, tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,153 @@
+// 同じプログラムを評価器と VM で実行して、かかった時間と割り当てたメモリを比べる。
+//
+//	go run ./benchmark                      # fibonacci(25) を両方で実行する
+//	go run ./benchmark -n 30 -engine vm     # fibonacci(30) を VM だけで実行する
+//	go run ./benchmark -input prog.monkey   # ファイルのプログラムを実行する
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"runtime"
+	"time"
+)
+
+// 何も指定しない時に実行するプログラム。%d を -n の値で置き換える
+const fibonacci = `
+let fibonacci = fn(x) {
+  if (x == 0) {
+    0
+  } else {
+    if (x == 1) {
+      return 1;
+    } else {
+      fibonacci(x - 1) + fibonacci(x - 2);
+    }
+  }
+};
+fibonacci(%d);
+`
+
+// 一つのエンジンで一回実行した結果
+type result struct {
+	value    object.Object
+	duration time.Duration
+	mallocs  uint64 // 割り当てたオブジェクトの数
+	bytes    uint64 // 割り当てたバイト数
+}
+
+func main() {
+	engine := flag.String("engine", "both", "use 'eval', 'vm' or 'both'")
+	n := flag.Int("n", 25, "argument passed to the default fibonacci workload")
+	input := flag.String("input", "", "run the program in this file instead of fibonacci")
+	flag.Parse()
+
+	l := lexer.New(fmt.Sprintf(fibonacci, *n))
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "benchmark: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		l = lexer.NewFromReader(f)
+	}
+
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "benchmark: %s\n", msg)
+		}
+		os.Exit(1)
+	}
+
+	engines := map[string]func(*ast.Program) (object.Object, error){
+		"eval": runEvaluator,
+		"vm":   runVM,
+	}
+
+	var names []string
+	switch *engine {
+	case "both":
+		names = []string{"eval", "vm"}
+	case "eval", "vm":
+		names = []string{*engine}
+	default:
+		fmt.Fprintf(os.Stderr, "benchmark: unknown engine %q\n", *engine)
+		os.Exit(2)
+	}
+
+	for _, name := range names {
+		r, err := measure(engines[name], program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "benchmark: %s: %s\n", name, err)
+			os.Exit(1)
+		}
+
+		value := "(none)" // let 文だけのプログラムは値を持たない
+		if r.value != nil {
+			value = r.value.Inspect()
+		}
+		fmt.Printf("engine=%s, result=%s, duration=%s, allocs=%d, bytes=%d\n",
+			name, value, r.duration, r.mallocs, r.bytes)
+	}
+}
+
+// run を一回実行して、かかった時間と、その間に割り当てたメモリを測る
+func measure(run func(*ast.Program) (object.Object, error), program *ast.Program) (result, error) {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	value, err := run(program)
+
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		return result{}, err
+	}
+
+	return result{
+		value:    value,
+		duration: duration,
+		mallocs:  after.Mallocs - before.Mallocs,
+		bytes:    after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+func runEvaluator(program *ast.Program) (object.Object, error) {
+	env := object.NewEnvironment()
+	value := evaluator.Eval(program, env)
+	if errObj, ok := value.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", errObj.Message)
+	}
+	return value, nil
+}
+
+// VM の計測にはコンパイルの時間も含める
+func runVM(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		return nil, fmt.Errorf("vm error: %s", err)
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
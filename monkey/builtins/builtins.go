@@ -0,0 +1,227 @@
+// 組み込み関数の表。評価器と VM のどちらも、ここにある同じ組み込み関数を呼び出す。
+// 最適化や解析も、組み込み関数の名前と作用をここから調べる
+package builtins
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/version"
+	"sort"
+)
+
+// 引数の型の仕様でよく使う組み合わせ
+var (
+	anyArg    []object.ObjectType // どの型でもよい
+	arrayArg  = []object.ObjectType{object.ARRAY_OBJ}
+	stringArg = []object.ObjectType{object.STRING_OBJ}
+)
+
+// 組み込み関数の名前とその実装。識別子を評価する時には、環境よりも先にここを探す。
+// 組み込み関数を追加する時は Signature と Doc も書いておくと、help() で表示される。
+// 引数の数と型は Spec に書いておけば Fn が呼ばれる前に確かめられるので、Fn の中では確かめなくてよい。
+// 入出力などの作用がある時は、それも Spec に書いておく
+var table = map[string]*object.Builtin{
+	// 文字列のバイト数か、配列の要素数を返す
+	"len": {
+		Signature: "len(value)",
+		Doc:       "Returns the number of bytes in a string or the number of elements in an array.",
+		Spec:      &object.BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]object.ObjectType{{object.STRING_OBJ, object.ARRAY_OBJ}}},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(len(arg.Value))}
+			default:
+				return &object.Integer{Value: int64(len(arg.(*object.Array).Elements))}
+			}
+		},
+	},
+
+	// 配列の最初の要素を返す。空の配列の時は NULL
+	"first": {
+		Signature: "first(array)",
+		Doc:       "Returns the first element of an array, or null if the array is empty.",
+		Spec:      &object.BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]object.ObjectType{arrayArg}},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			arr := args[0].(*object.Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return object.NULL
+		},
+	},
+
+	// 配列の最後の要素を返す。空の配列の時は NULL
+	"last": {
+		Signature: "last(array)",
+		Doc:       "Returns the last element of an array, or null if the array is empty.",
+		Spec:      &object.BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]object.ObjectType{arrayArg}},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+			return object.NULL
+		},
+	},
+
+	// 最初の要素を除いた新しい配列を返す。空の配列の時は NULL
+	"rest": {
+		Signature: "rest(array)",
+		Doc:       "Returns a new array with all elements but the first, or null if the array is empty.",
+		Spec:      &object.BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]object.ObjectType{arrayArg}},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]object.Object, length-1)
+				copy(newElements, arr.Elements[1:])
+				return &object.Array{Elements: newElements}
+			}
+			return object.NULL
+		},
+	},
+
+	// 引数を一つづつ Inspect() して、それぞれ一行として環境の出力先に書き出す。常に NULL を返す
+	"puts": {
+		Signature: "puts(values...)",
+		Doc:       "Prints each value on its own line and returns null.",
+		Spec:      &object.BuiltinSpec{MinArgs: 0, MaxArgs: object.VariadicArgs, IO: true},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			out := env.Output()
+			for _, arg := range args {
+				io.WriteString(out, arg.Inspect())
+				io.WriteString(out, "\n")
+			}
+			return object.NULL
+		},
+	},
+
+	// 末尾に要素を追加した新しい配列を返す。引数の配列は変更しない
+	"push": {
+		Signature: "push(array, value)",
+		Doc:       "Returns a new array with value appended. The given array is not modified.",
+		Spec:      &object.BuiltinSpec{MinArgs: 2, MaxArgs: 2, ArgTypes: [][]object.ObjectType{arrayArg, anyArg}},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			newElements := make([]object.Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &object.Array{Elements: newElements}
+		},
+	},
+}
+
+// help と builtins は組み込み関数の表そのものを参照するので、表の初期化式ではなく init() で追加する
+// (初期化式に書くと初期化の循環になってしまう)。Name の設定と、Spec を確かめる処理で Fn を包むのもここでまとめて行う
+func init() {
+	// 組み込み関数の説明を環境の出力先に書き出す。常に NULL を返す
+	table["help"] = &object.Builtin{
+		Signature: "help(name)",
+		Doc:       "Prints the signature and description of the builtin function with the given name.",
+		Spec:      &object.BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]object.ObjectType{stringArg}, IO: true},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			name := args[0].(*object.String)
+			doc, ok := Doc(name.Value)
+			if !ok {
+				return newError("help: no builtin function named %s", name.Value)
+			}
+			io.WriteString(env.Output(), doc)
+			return object.NULL
+		},
+	}
+
+	// 組み込み関数の名前を辞書順に並べた、文字列の配列を返す
+	table["builtins"] = &object.Builtin{
+		Signature: "builtins()",
+		Doc:       "Returns the names of all builtin functions as an array of strings.",
+		Spec:      &object.BuiltinSpec{MinArgs: 0, MaxArgs: 0},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			names := Names()
+			elements := make([]object.Object, len(names))
+			for i, name := range names {
+				elements[i] = &object.String{Value: name}
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+
+	// インタプリタのバージョンとビルドの情報を、ハッシュにして返す。--version と同じ内容になる
+	table["version"] = &object.Builtin{
+		Signature: "version()",
+		Doc:       "Returns a hash with the version, git commit, Go version and features of this interpreter.",
+		Spec:      &object.BuiltinSpec{MinArgs: 0, MaxArgs: 0},
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			features := map[string]object.Object{}
+			for name, enabled := range version.Features {
+				features[name] = object.NativeBool(enabled)
+			}
+			return newHash(map[string]object.Object{
+				"version":  &object.String{Value: version.Version},
+				"commit":   &object.String{Value: version.Commit()},
+				"go":       &object.String{Value: version.GoVersion()},
+				"features": newHash(features),
+			})
+		},
+	}
+
+	for name, builtin := range table {
+		builtin.Name = name
+		if builtin.Spec != nil {
+			builtin.Fn = checkArgs(name, builtin.Spec, builtin.Fn)
+		}
+	}
+}
+
+// 引数が spec を満たしている時だけ fn を呼び出す組み込み関数を返す
+func checkArgs(name string, spec *object.BuiltinSpec, fn object.BuiltinFunction) object.BuiltinFunction {
+	return func(env *object.Environment, args ...object.Object) object.Object {
+		if err := spec.Check(name, args); err != nil {
+			return err
+		}
+		return fn(env, args...)
+	}
+}
+
+// 組み込み関数の名前を辞書順に返す
+func Names() []string {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 名前の組み込み関数を返す。そういう名前の組み込み関数がない時は false を返す
+func Lookup(name string) (*object.Builtin, bool) {
+	builtin, ok := table[name]
+	return builtin, ok
+}
+
+// 名前の組み込み関数の呼び出し方と説明を、help() や REPL の :doc で表示する形にして返す。
+// そういう名前の組み込み関数がない時は false を返す
+func Doc(name string) (string, bool) {
+	builtin, ok := table[name]
+	if !ok {
+		return "", false
+	}
+	return builtin.Signature + "\n    " + builtin.Doc + "\n", true
+}
+
+// 文字列をキーにしたハッシュを作る
+func newHash(pairs map[string]object.Object) *object.Hash {
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	for k, v := range pairs {
+		key := &object.String{Value: k}
+		hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: v}
+	}
+	return hash
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,34 @@
+package builtins
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinMetadata(t *testing.T) {
+	for _, name := range Names() {
+		builtin := table[name]
+		if builtin.Name != name {
+			t.Errorf("table[%q].Name wrong. got=%q", name, builtin.Name)
+		}
+		if !strings.HasPrefix(builtin.Signature, name+"(") {
+			t.Errorf("table[%q].Signature does not start with the name. got=%q", name, builtin.Signature)
+		}
+		if builtin.Doc == "" {
+			t.Errorf("table[%q] has no Doc", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range Names() {
+		builtin, ok := Lookup(name)
+		if !ok || builtin.Name != name {
+			t.Errorf("Lookup(%q) wrong. got=%v, %t", name, builtin, ok)
+		}
+	}
+
+	if _, ok := Lookup("quote"); ok {
+		t.Errorf("quote is a special form, not a builtin function")
+	}
+}
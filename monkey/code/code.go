@@ -0,0 +1,242 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 命令列。一つの命令は 1 バイトのオペコードと、それに続くオペランドからなる
+type Instructions []byte
+
+// 命令列を一命令一行の、人が読める形にして返す。各行の先頭は命令の位置(バイト単位)
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++ // 未定義のオペコードは読み飛ばして続ける
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// 命令の種類
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 定数プールの添字のオペランドが指す定数をスタックに積む
+
+	// スタックから二つ取り出して演算し、結果を積む
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue  // true を積む
+	OpFalse // false を積む
+
+	// スタックから二つ取り出して比較し、結果の真偽値を積む
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+
+	// スタックから一つ取り出して演算し、結果を積む
+	OpMinus
+	OpBang
+
+	OpPop // 式文の値をスタックから取り除く
+
+	// オペランドは飛び先の命令の位置
+	OpJumpNotTruthy // スタックから一つ取り出して、真でない時だけ飛ぶ
+	OpJump          // 無条件に飛ぶ
+
+	OpNull // null を積む
+
+	// オペランドはグローバル変数の添字
+	OpGetGlobal // グローバル変数の値を積む
+	OpSetGlobal // スタックから一つ取り出して、グローバル変数に束縛する
+
+	OpCall        // オペランドは引数の数。スタックに関数と引数を積んだ状態で、関数を呼び出す
+	OpReturnValue // スタックから一つ取り出して、それを呼び出しの値として呼び出し元に戻る
+	OpReturn      // null を呼び出しの値として呼び出し元に戻る
+
+	// オペランドは局所変数の添字
+	OpGetLocal // 局所変数の値を積む
+	OpSetLocal // スタックから一つ取り出して、局所変数に束縛する
+
+	// オペランドは関数の定数の添字と自由変数の数。スタックから自由変数の値を取り出して、関数と一緒にクロージャにして積む
+	OpClosure
+	OpGetFree        // オペランドは自由変数の添字。実行中のクロージャが捕捉した値を積む
+	OpCurrentClosure // 実行中のクロージャ自身を積む。let で束縛した関数が自分を呼び出す時に使う
+
+	OpGetBuiltin // オペランドは compiler.Builtins の添字。その組み込み関数を積む
+
+	// スタックから二つ取り出して比較し、結果の真偽値を積む。
+	// 左右を入れ替えて > と >= にすると被演算子を評価する順序が変わってしまうので、別の命令にする
+	OpLessThan
+	OpLessThanOrEqual
+)
+
+// オペコードの名前を返す。たとえば OpAdd なら "OpAdd"
+func (op Opcode) String() string {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Sprintf("Opcode(%d)", byte(op))
+	}
+	return def.Name
+}
+
+// オペコードの定義。名前はデバッグ用の表示に使う
+type Definition struct {
+	Name          string
+	OperandWidths []int // 各オペランドのバイト数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpPop: {"OpPop", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpNull: {"OpNull", []int{}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetLocal: {"OpGetLocal", []int{1}},
+	OpSetLocal: {"OpSetLocal", []int{1}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpLessThan:        {"OpLessThan", []int{}},
+	OpLessThanOrEqual: {"OpLessThanOrEqual", []int{}},
+}
+
+// オペコードの定義を返す。定義されていないオペコードの時はエラーを返す
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// オペコードとオペランドから一つの命令を組み立てる。オペランドはビッグエンディアンで書き込む。
+// 定義されていないオペコードの時は空の命令を返す
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// Make の逆。オペコードの後ろのオペランドを読み出して、読んだバイト数と一緒に返す
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// 2 バイトのオペランドを読み出す。VM の命令の実行ループからも使う
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// 1 バイトのオペランドを読み出す
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
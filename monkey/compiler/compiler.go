@@ -0,0 +1,488 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/builtins"
+	"monkey/code"
+	"monkey/object"
+)
+
+// AST をたどってバイトコードを生成するコンパイラ。
+// 今のところ整数と真偽値のリテラル、算術演算、比較、前置演算子と if 式、let と識別子、関数とクロージャと関数呼び出し、組み込み関数だけを扱う
+type Compiler struct {
+	constants []object.Object // 定数プール。OpConstant のオペランドはここの添字
+
+	symbolTable *SymbolTable
+
+	// 関数リテラルの本体はその関数の命令列にコンパイルするので、コンパイル中の関数ごとに命令列を分けて持つ。
+	// scopes[0] がトップレベルで、scopes[scopeIndex] が今コンパイルしている関数
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+// 一つの関数(かトップレベル)の命令列と、その末尾の命令
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction // 最後に追加した命令
+	previousInstruction EmittedInstruction // lastInstruction の一つ前の命令
+}
+
+// 追加した命令のオペコードと位置
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	defineBuiltins(symbolTable)
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// 前回のコンパイルの記号表と定数プールを引き継いだコンパイラを生成する。
+// REPL で前の行で let した名前を次の行でも使えるようにする時に使う。組み込み関数は s にも定義する
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	defineBuiltins(s)
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// 組み込み関数の一覧。OpGetBuiltin のオペランドはこの添字で、VM も同じ一覧から組み込み関数を積む。
+// 評価器と同じ組み込み関数を名前の辞書順に並べる
+var Builtins = func() []*object.Builtin {
+	list := []*object.Builtin{}
+	for _, name := range builtins.Names() {
+		builtin, _ := builtins.Lookup(name)
+		list = append(list, builtin)
+	}
+	return list
+}()
+
+func defineBuiltins(s *SymbolTable) {
+	for i, builtin := range Builtins {
+		s.DefineBuiltin(i, builtin.Name)
+	}
+}
+
+// ノードをコンパイルして、命令を命令列の末尾に追加する。
+// まだ扱えないノードや演算子に出会った時はエラーを返す
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop) // 式文の値は使われないので、スタックに残さない
+
+	case *ast.InfixExpression:
+		// 評価器と同じく、左辺を先に評価する
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// 飛び先はまだわからないので仮の値にしておき、後で書き換える
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBranch(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull) // else がなく条件が真でない時の値は null
+		} else {
+			err := c.compileBranch(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			// 束縛する関数の中では、その名前で関数自身を参照できるようにする
+			err = c.compileFunctionLiteral(fn, node.Name.Value)
+		} else {
+			err = c.Compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+		// 値を先にコンパイルするので、let x = x; の右辺の x は外側の x を指す
+		symbol := c.symbolTable.Define(node.Name.Value)
+		err = c.storeSymbol(symbol)
+		if err != nil {
+			return err
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		err := c.loadSymbol(symbol)
+		if err != nil {
+			return err
+		}
+
+	case *ast.FunctionLiteral:
+		err := c.compileFunctionLiteral(node, "")
+		if err != nil {
+			return err
+		}
+
+	case *ast.ReturnStatement:
+		if c.scopeIndex == 0 {
+			return fmt.Errorf("return outside of a function is not supported")
+		}
+
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.InlinedCall:
+		return c.Compile(node.Body) // VM はスタックトレースを記録しないので、本体だけをコンパイルする
+
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	default:
+		return fmt.Errorf("unsupported node: %s", node.Kind())
+	}
+
+	return nil
+}
+
+// 関数リテラルの本体を新しいスコープでコンパイルして、クロージャを作る命令を追加する。
+// name は関数を束縛する let の名前で、関数の中からはその名前で関数自身を参照できる。let で束縛しない時は空文字列
+func (c *Compiler) compileFunctionLiteral(fn *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range fn.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(fn.Body)
+	if err != nil {
+		return err
+	}
+
+	// 最後の式文の値が関数の値になる。値のない本体は null を返す
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+
+	// 捕捉する値は外側のスコープで読み出して、OpClosure の前に積んでおく
+	for _, s := range freeSymbols {
+		err := c.loadSymbol(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(fn.Parameters),
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// if 式の枝をコンパイルする。枝の値は if 式の値としてスタックに残さなければならないので、最後の OpPop を取り除く。
+// 値を持たない枝(空のブロックなど)の時は null を積む
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if len(block.Statements) > 0 && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// 関数リテラルの本体をコンパイルするために、新しい命令列と記号表を用意する
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// 関数リテラルの本体のコンパイルを終えて外側に戻り、本体の命令列を返す
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+// 関数本体の最後の OpPop を OpReturnValue に置き換えて、最後の式文の値を返すようにする
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// pos にある命令を、同じ長さの新しい命令 newInstruction で置き換える
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// pos にある命令のオペランドを書き換える。飛び先が後からわかるジャンプ命令に使う
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// symbol の値をスタックに積む命令を追加する
+func (c *Compiler) loadSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	default:
+		return fmt.Errorf("unsupported scope %s for %s", s.Scope, s.Name)
+	}
+	return nil
+}
+
+// スタックから取り出した値を symbol に束縛する命令を追加する
+func (c *Compiler) storeSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	default:
+		return fmt.Errorf("unsupported scope %s for %s", s.Scope, s.Name)
+	}
+	return nil
+}
+
+// 定数プールに定数を追加して、その添字を返す
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// 命令を組み立てて命令列の末尾に追加し、その命令の位置を返す
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+// コンパイルした結果を返す。VM はこれを受け取って実行する
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+// コンパイラが生成した命令列と定数プール
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
@@ -0,0 +1,112 @@
+package compiler
+
+// 識別子が束縛されている場所の種類。どの命令で値を読み書きするかが決まる
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"   // トップレベルの let。VM のグローバル変数の領域に置く
+	LocalScope    SymbolScope = "LOCAL"    // 関数の中の let と仮引数。呼び出しごとのスタックの領域に置く
+	BuiltinScope  SymbolScope = "BUILTIN"  // 組み込み関数。Index は組み込み関数の一覧の添字
+	FreeScope     SymbolScope = "FREE"     // 外側の関数の局所変数。クロージャが捕捉した値から読む
+	FunctionScope SymbolScope = "FUNCTION" // let で束縛した関数の中での、その関数自身の名前
+)
+
+// 識別子の名前と、その値を読み書きする場所
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int // スコープの中での添字
+}
+
+// 名前を Symbol に対応づける表。関数をコンパイルする時は、外側の表を持つ新しい表を作る
+type SymbolTable struct {
+	Outer *SymbolTable // 外側の表。トップレベルの表では nil
+
+	store          map[string]Symbol
+	builtins       map[string]Symbol // DefineBuiltin した組み込み関数。let や仮引数の名前よりも優先される
+	numDefinitions int               // この表で Define した名前の数。次に Define する名前の添字になる
+
+	FreeSymbols []Symbol // この表で捕捉した外側の局所変数の、外側の表での Symbol。捕捉した順に並ぶ
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, builtins: map[string]Symbol{}, FreeSymbols: free}
+}
+
+// outer を外側に持つ新しい表を生成する。この表で定義した名前は局所変数になる
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// 名前を定義して、その Symbol を返す。トップレベルの表ではグローバル変数に、それ以外では局所変数になる。
+// 同じ名前をもう一度定義した時は、新しい添字で定義し直す
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// 組み込み関数の名前を、組み込み関数の一覧の添字 index で定義する。
+// 評価器と同じく、組み込み関数の名前はこの表の内側でも外側でも、let や仮引数で束縛し直せない
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.builtins[name] = symbol
+	return symbol
+}
+
+// コンパイル中の関数を let で束縛する名前を定義する。関数の中からその名前で自分自身を呼び出せるようにする。
+// 仮引数や局所変数に同じ名前がある時は、後から Define したそちらが優先される
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// 外側の表の局所変数 original を、この表で捕捉した自由変数として定義する
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// 名前の Symbol を探す。組み込み関数の名前を先に探してから、この表とその外側の表を順にたどる。
+// 外側の関数の局所変数が見つかった時は、それをこの表の自由変数として定義してから返す。
+// グローバル変数と組み込み関数はどこからでも同じ場所を読めるので、そのまま返す
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	for t := s; t != nil; t = t.Outer {
+		if builtin, ok := t.builtins[name]; ok {
+			return builtin, true
+		}
+	}
+
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
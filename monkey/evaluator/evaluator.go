@@ -0,0 +1,646 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"monkey/ast"
+	"monkey/builtins"
+	"monkey/object"
+)
+
+// 組み込み関数が返す値と同じインスタンスにしておく
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+// ASTノードを受け取って、その種類に応じて評価した結果の値を返す
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// 文
+	case *ast.Program:
+		return evalProgram(node, env)
+
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if result := env.Set(node.Name.Value, val); isError(result) {
+			return result
+		}
+		return NULL
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	// 式
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.PrefixExpression:
+		if node.Operator == "++" || node.Operator == "--" {
+			return evalUpdateExpression(node.Operator, node.Right, true, env)
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+
+	case *ast.PostfixExpression:
+		return evalUpdateExpression(node.Operator, node.Left, false, env)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+
+	case *ast.MacroLiteral: // トップレベルの let で束縛したマクロは、評価する前に DefineMacros が取り除く
+		return newError("macro can only be defined by a top-level let statement")
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" { // quote は引数を評価しない特別な形式
+			if len(node.Arguments) != 1 {
+				return newError("quote: expected 1 argument, got %d", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		result := applyFunction(function, args, env)
+		if err, ok := result.(*object.Error); ok {
+			// エラーが呼び出し元に伝わっていく途中で、通ってきた呼び出しを記録する
+			err.Stack = append(err.Stack, object.StackFrame{Function: node.Function.String(), Pos: node.Token.Pos()})
+		}
+		return result
+
+	case *ast.InlinedCall:
+		result := Eval(node.Body, env)
+		if err, ok := result.(*object.Error); ok {
+			// 展開しなかった時と同じスタックトレースになるように、展開した呼び出しも記録する
+			err.Stack = append(err.Stack, object.StackFrame{Function: node.Function.String(), Pos: node.Token.Pos()})
+		}
+		return result
+	}
+
+	return newError("cannot evaluate %s", node.Kind())
+}
+
+// プログラムの文を順に評価して、最後に評価した値を返す。return文に出会ったらそこで評価をやめて、ラップを外した値を返す。
+// エラーに出会った時もそこで評価をやめて、そのエラーを返す。文が一つもない時は NULL になる
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// ブロック文の文を順に評価する。ネストしたブロックの外側まで return とエラーを伝えるために、ReturnValue はラップしたまま返す。
+// 空のブロックは NULL になる
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		rt := result.Type()
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return result
+		}
+	}
+
+	return result
+}
+
+// 初期化の let 文はループ用の環境に束縛するので、ループ変数は for 文の外からは見えない。
+// 本体もその環境で評価するので、本体の let でループ変数を更新できる。return かエラーに出会った時以外は NULL を返す
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fs.Init != nil {
+		if err := Eval(fs.Init, loopEnv); isError(err) {
+			return err
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				break
+			}
+		}
+
+		result := Eval(fs.Body, loopEnv)
+		if rt := result.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return result
+		}
+
+		if fs.Post != nil {
+			if post := Eval(fs.Post, loopEnv); isError(post) {
+				return post
+			}
+		}
+	}
+
+	return NULL
+}
+
+// ++ と -- を評価する。識別子の今の値を読み、1 を足すか引いた値を、その識別子が束縛されている環境に書き戻す。
+// 前置(++x)の時は更新した後の値を、後置(x++)の時は更新する前の値を返す。
+// 識別子が束縛されていない時や、値が数値でない時には何も更新せずにエラーを返す
+func evalUpdateExpression(operator string, operand ast.Expression, prefix bool, env *object.Environment) object.Object {
+	ident, ok := operand.(*ast.Identifier)
+	if !ok { // 構文解析でエラーになるので、ここに来ることはない
+		return newError("operand of %s must be an identifier, got %s", operator, operand.String())
+	}
+
+	old, ok := env.Get(ident.Value)
+	if !ok {
+		return newError("identifier not found: %s", ident.Value)
+	}
+	if !isNumber(old) {
+		if prefix {
+			return newError("unknown operator: %s%s", operator, old.Type())
+		}
+		return newError("unknown operator: %s%s", old.Type(), operator)
+	}
+
+	delta := "+"
+	if operator == "--" {
+		delta = "-"
+	}
+	updated := evalInfixExpression(delta, old, &object.Integer{Value: 1})
+	if !env.Assign(ident.Value, updated) { // 見つかった束縛を書き換えられないのは、読み取り専用の環境にある時だけ
+		return newError("cannot assign to %s: environment is read-only", ident.Value)
+	}
+
+	if prefix {
+		return updated
+	}
+	return old
+}
+
+// 評価の結果がエラーかどうか。エラーはそれ以上評価を進めずに、そのまま呼び出し元に返していく
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	return object.NativeBool(input)
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// false と null 以外の値はすべて truthy として扱う
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	// 片方でも浮動小数点数の時には、整数を浮動小数点数に昇格してから計算する
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, toFloat(left), toFloat(right))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	// 真偽値は TRUE と FALSE のインスタンスを使い回しているので、ポインタの比較で等しさを判定できる
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d %s %d", leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %s %d", leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 { // 負の指数の時は結果が整数にならないので、浮動小数点数で計算する
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &object.Integer{Value: intPow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, leftVal, rightVal float64) object.Object {
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal} // 0 で割った時は IEEE 754 にしたがって Inf か NaN になる
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: FLOAT %s FLOAT", operator)
+	}
+}
+
+// 繰り返し二乗法で base の exp 乗を求める。exp は 0 以上でなければならない。桁あふれした時は int64 の演算と同じく折り返す
+func intPow(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+// 文字列どうしでは連結と、値による等しさの比較だけができる
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// 整数か浮動小数点数の値を float64 にして返す
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// && と || を評価する。左側の値だけで結果が決まる時には右側の式を評価しない。結果はエラーの時を除いて常に真偽値になる
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	leftObj := Eval(node.Left, env)
+	if isError(leftObj) {
+		return leftObj
+	}
+	left := isTruthy(leftObj)
+
+	if node.Operator == "&&" && !left {
+		return FALSE
+	}
+	if node.Operator == "||" && left {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// 条件が truthy なら Consequence を、そうでなければ Alternative を評価する。Alternative がない時には NULL になる
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// 識別子に対応する値を探す。組み込み関数の名前は let で覆い隠せないように、環境よりも先に探す。
+// どちらにも見つからない時にはエラーを返す
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if builtin, ok := builtins.Lookup(node.Value); ok {
+		return builtin
+	}
+
+	val, ok := env.Get(node.Value)
+	if !ok {
+		return newError("identifier not found: %s", node.Value)
+	}
+
+	return val
+}
+
+// 添字演算子を評価する。配列とハッシュ以外に添字演算子を使った時にはエラーを返す
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexExpression(left, index)
+	case *object.Hash:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// 配列の添字演算子を評価する。範囲外の添字の時には NULL を、添字が整数でない時にはエラーを返す
+func evalArrayIndexExpression(array *object.Array, index object.Object) object.Object {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return newError("index must be INTEGER, got %s", index.Type())
+	}
+
+	if idx.Value < 0 || idx.Value >= int64(len(array.Elements)) {
+		return NULL
+	}
+
+	return array.Elements[idx.Value]
+}
+
+// ハッシュの添字演算子を評価する。キーがない時には NULL を、キーとして使えない値の時にはエラーを返す
+func evalHashIndexExpression(hash *object.Hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// ハッシュリテラルを評価する。キーと値は組ごとに キー、値 の順に評価する
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for keyNode, valueNode := range node.Pairs {
+		key := Eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(valueNode, env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// 式のリストを左から順に評価する。関数呼び出しの引数の評価に使う。
+// 途中でエラーになった時は残りの式を評価せずに、そのエラーだけを要素に持つスライスを返す
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// 関数定義時の環境を外側に持つ新しい環境に引数を束縛して、関数本体を評価する。組み込み関数には呼び出した環境を渡して Go の関数を呼び出す
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := Eval(fn.Body, extendedEnv)
+		return unwrapReturnValue(evaluated)
+
+	case *object.Builtin:
+		return fn.Fn(env, args...)
+
+	case *object.Macro: // マクロの本体からほかのマクロを呼び出した時など、展開されずに残った呼び出し
+		return newError("macro cannot be called at runtime")
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+		} else {
+			env.Set(param.Value, NULL) // 引数が足りない仮引数は null に束縛する
+		}
+	}
+
+	return env
+}
+
+// 関数本体の return は呼び出し元の評価まで止めてはいけないので、ここでラップを外す
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
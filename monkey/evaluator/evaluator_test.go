@@ -0,0 +1,1266 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/version"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"9 % 3", 0},
+		{"-7 % 3", -1},
+		{"1 + 10 % 4 * 2", 5},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"3 ** 0", 1},
+		{"2 * 3 ** 2", 18},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"0.5 * 4.0", 2.0},
+		{"7.5 / 2.5", 3.0},
+		{"5.5 % 2.0", 1.5},
+		{"2.0 ** 3", 8.0},
+		{"4 ** 0.5", 2.0},
+		{"2 ** -1", 0.5},
+		// 整数と浮動小数点数が混ざると浮動小数点数に昇格する
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"3 / 2.0", 1.5},
+		{"2 * 1.5 - 1", 2.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 <= 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"1 >= 1", true},
+		{"2 >= 1", true},
+		{"(1 <= 2) == (2 >= 1)", true},
+		{"1.5 < 2", true},
+		{"2 <= 1.5", false},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || false", false},
+		{"false || true", true},
+		{"true || false", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 && 0", true},
+		{"if (false) { 1 } || 2", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	// 右側の式が評価されると再帰が止まらなくなるので、短絡評価されていればそのまま結果が返る
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let loop = fn() { loop() }; false && loop()", false},
+		{"let loop = fn() { loop() }; true || loop()", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestFunctionScope(t *testing.T) {
+	// 関数本体での let は呼び出し元の環境の束縛を書き換えない
+	input := `
+let x = 1;
+let f = fn() { let x = 2; x };
+f() + x;`
+
+	testIntegerObject(t, testEval(input), 3)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 本体の let でループ変数を更新できる
+		{"let f = fn(n) { for (let i = 0; true; i) { if (i == n) { return i * 10 } let i = i + 1 } }; f(3)", 30},
+		{"let f = fn() { for (let i = 0; i < 3; i) { let i = i + 1 } return 1 }; f()", 1},
+		// 条件が最初から偽なら本体は評価されない
+		{"let f = fn() { for (let i = 0; false; i) { return 1 } return 2 }; f()", 2},
+		{"for (let i = 0; false; i) {}", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStatementsWithoutValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // 値の時は Inspect() の結果、エラーの時は *object.Error のメッセージ
+	}{
+		// 値を持たない文とブロックは NULL になる
+		{"", "null"},
+		{"let x = 1", "null"},
+		{"if (true) {}", "null"},
+		{"if (true) { let x = 1 }", "null"},
+		{"fn() {}()", "null"},
+		{"for (let i = 0; false; i) {}", "null"},
+		{"[fn() {}()]", "[null]"},
+		{"!fn() {}()", "true"},
+		{"fn() {}() == if (true) {}", "true"},
+		// 演算子や組み込み関数には NULL として渡る
+		{"-if (true) {}", &object.Error{Message: "unknown operator: -NULL"}},
+		{"if (true) {}[0]", &object.Error{Message: "index operator not supported: NULL"}},
+		{"let x = if (true) {}; len(x)", &object.Error{Message: "len: argument 1 must be STRING or ARRAY, got NULL"}},
+		{"{if (true) {}: 1}", &object.Error{Message: "unusable as hash key: NULL"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong value for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case *object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected.Message {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected.Message, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 5; ++i", 6},
+		{"let i = 5; i++", 5}, // 後置の時は更新する前の値になる
+		{"let i = 5; i++; i", 6},
+		{"let i = 5; --i", 4},
+		{"let i = 5; i--; i", 4},
+		{"let i = 1.5; ++i", 2.5},
+		// 左の被演算子から順に評価する
+		{"let i = 1; i++ + i", 3},
+		{"let i = 1; ++i + i++ + i", 7},
+		// 束縛されている外側の環境の値が更新される
+		{"let n = 0; let inc = fn() { n++ }; inc(); inc(); n", 2},
+		{"let newCounter = fn() { let c = 0; fn() { ++c } }; let next = newCounter(); next(); next()", 2},
+		{"let sum = 0; for (let i = 1; i <= 4; i++) { let sum = sum + i } sum", 0}, // 本体の let はループの環境の新しい束縛になる
+		{"let f = fn() { let n = 0; for (let i = 0; i < 4; i++) { n++ } n }; f()", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 別々に評価された文字列でも、値が同じなら等しい
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`let s = "foo"; s + "bar" == "foobar"`, true},
+		{`"" == ""`, true},
+		{`"say \"hi\"" == "say " + "\u{22}hi\u{22}"`, true},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{`"a" < "b"`, "unknown operator: STRING < STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([])`, 0},
+		{`len([1, 2, 3])`, 3},
+		{`let a = [1, 2]; len(a) + len("abc")`, 5},
+		{`len(1)`, "len: argument 1 must be STRING or ARRAY, got INTEGER"},
+		{`len("one", "two")`, "len: expected 1 argument, got 2"},
+		{`len()`, "len: expected 1 argument, got 0"},
+		// 組み込み関数は環境よりも先に探されるので、let で覆い隠せない
+		{`let len = fn(x) { 100 }; len("a")`, 1},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "first: argument 1 must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "last: argument 1 must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([1])`, []int{}},
+		{`rest([])`, nil},
+		{`rest([1], [2])`, "rest: expected 1 argument, got 2"},
+		{`push([], 1)`, []int{1}},
+		{`push([1, 2], 3)`, []int{1, 2, 3}},
+		{`push(1, 1)`, "push: argument 1 must be ARRAY, got INTEGER"},
+		{`push([1])`, "push: expected 2 arguments, got 1"},
+		// push と rest は新しい配列を返し、引数の配列は変わらない
+		{`let a = [1, 2]; let b = push(a, 3); a`, []int{1, 2}},
+		{`let a = [1, 2]; let b = rest(a); a`, []int{1, 2}},
+		{`let a = [1, 2]; let b = push(a, 3); let c = push(a, 4); b`, []int{1, 2, 3}},
+		{`help(1)`, "help: argument 1 must be STRING, got INTEGER"},
+		{`help("nothing")`, "help: no builtin function named nothing"},
+		{`help()`, "help: expected 1 argument, got 0"},
+		{`len(builtins())`, 9},
+		{`if (first(builtins()) == "builtins") { 1 } else { 0 }`, 1}, // 名前は辞書順に並ぶ
+		{`builtins(1)`, "builtins: expected 0 arguments, got 1"},
+		{`if (version()["version"] == "` + version.Version + `") { 1 } else { 0 }`, 1},
+		{`if (version()["go"] == "` + version.GoVersion() + `") { 1 } else { 0 }`, 1},
+		{`len(version()["commit"]) > 0`, true},
+		{`version()["features"]["macros"]`, true},
+		{`version()["features"]["modules"]`, false},
+		{`version(1)`, "version: expected 0 arguments, got 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	input := `
+let greet = fn(name) { puts("hello", name) };
+greet("monkey");
+puts([1, 2], true);
+puts();`
+
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+
+	// 関数本体の環境も外側の環境の出力先を引き継ぐ
+	evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	testNullObject(t, evaluated)
+
+	expected := "hello\nmonkey\n[1, 2]\ntrue\n"
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestHelp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`help("len")`, "len(value)\n    Returns the number of bytes in a string or the number of elements in an array.\n"},
+		{`help("help")`, "help(name)\n    Prints the signature and description of the builtin function with the given name.\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetOutput(&out)
+
+		evaluated := Eval(testParseProgram(tt.input), env)
+		testNullObject(t, evaluated)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{"foobar", "identifier not found: foobar"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"10 % 0", "division by zero: 10 % 0"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{`[1][true]`, "index must be INTEGER, got BOOLEAN"},
+		{"1(2)", "not a function: INTEGER"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{"a": foo}`, "identifier not found: foo"},
+		{"quote(1, 2)", "quote: expected 1 argument, got 2"},
+		{"x++", "identifier not found: x"},
+		{"let b = true; b++", "unknown operator: BOOLEAN++"},
+		{"let b = true; --b", "unknown operator: --BOOLEAN"},
+		// ループ変数は for 文の外からは見えない
+		{"for (let i = 0; false; i) {} i", "identifier not found: i"},
+		// エラーはそれ以上評価を進めずに伝わっていく
+		{"let x = 1 + true; x", "type mismatch: INTEGER + BOOLEAN"},
+		{"[1, foo, bar]", "identifier not found: foo"},
+		{"len(foo, bar)", "identifier not found: foo"},
+		{"foo && loop()", "identifier not found: foo"},
+		{"true && foo", "identifier not found: foo"},
+		{"for (let i = 0; foo; i) {}", "identifier not found: foo"},
+		{"let f = fn() { for (;;) { return -true } }; f()", "unknown operator: -BOOLEAN"},
+		// トップレベルの let 以外で定義したマクロは展開されずに残る
+		{"let f = fn() { let m = macro() { quote(1) }; m() }; f()", "macro can only be defined by a top-level let statement"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let inner = fn(x) { x + true };
+let outer = fn() { inner(1) };
+outer()`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	// エラーが起きた場所に近い呼び出しから順に並ぶ
+	expected := "ERROR: type mismatch: INTEGER + BOOLEAN\n\tat inner (2:25)\n\tat outer (3:6)"
+	if errObj.Inspect() != expected {
+		t.Errorf("wrong Inspect(). expected=%q, got=%q", expected, errObj.Inspect())
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("price", &object.Integer{Value: 120})
+	env.Set("limit", &object.Integer{Value: 100})
+
+	result, err := EvalExpr("price > limit && price % 2 == 0", env)
+	if err != nil {
+		t.Fatalf("EvalExpr returned error: %v", err)
+	}
+	testBooleanObject(t, result, true)
+
+	// 構文解析のエラー
+	if _, err := EvalExpr("let x = 1", env); err == nil {
+		t.Errorf("EvalExpr accepted a let statement")
+	} else if _, ok := err.(*parser.ParseError); !ok {
+		t.Errorf("error is not *parser.ParseError. got=%T", err)
+	}
+
+	// 評価中のエラー
+	_, err = EvalExpr("price + missing", env)
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("error is not *object.Error. got=%T (%v)", err, err)
+	}
+	if errObj.Message != "identifier not found: missing" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestObjectLiteral(t *testing.T) {
+	seconds := ObjectLiteral(func(literal string) (object.Object, error) {
+		n, err := strconv.ParseInt(strings.TrimSuffix(literal, "s"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: n * 1000}, nil
+	})
+	points := ObjectLiteral(func(literal string) (object.Object, error) {
+		return &object.Array{Elements: []object.Object{}}, nil
+	})
+
+	p := parser.New(lexer.New(`let timeout = 5s; timeout + 250`))
+	p.RegisterLiteral("s", seconds)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	testIntegerObject(t, Eval(program, object.NewEnvironment()), 5250)
+
+	p = parser.New(lexer.New(`3pt`))
+	p.RegisterLiteral("pt", points)
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != "1:1: could not parse 3pt: ARRAY cannot be used as a literal value" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+func TestNumberLiteralsWithUnderscores(t *testing.T) {
+	testIntegerObject(t, testEval("1_000_000 + 1"), 1000001)
+	testFloatObject(t, testEval("0.000_5 * 2"), 0.001)
+}
+
+func TestPrelude(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", []int64{2, 4, 6}},
+		{"map([], fn(x) { x })", []int64{}},
+		{"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })", []int64{2, 4}},
+		{"reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })", 10},
+		{"reduce(map([1, 2, 3], fn(x) { x * x }), 0, fn(acc, x) { acc + x })", 14},
+		{"let map = fn(x) { x }; map(5)", 5}, // プレリュードの関数も let で束縛し直せる
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong num of elements for %q. want=%d, got=%d", tt.input, len(expected), len(arr.Elements))
+				continue
+			}
+			for i, e := range expected {
+				testIntegerObject(t, arr.Elements[i], e)
+			}
+		}
+	}
+
+	// プレリュードを読み込まない環境には束縛されない
+	errObj, ok := testEval("map([1], fn(x) { x })").(*object.Error)
+	if !ok || errObj.Message != "identifier not found: map" {
+		t.Errorf("map is bound without the prelude. got=%v", errObj)
+	}
+}
+
+func TestNewEnvironmentWithPreludes(t *testing.T) {
+	env, err := NewEnvironmentWithPreludes(
+		Prelude{Name: "pricing.mky", Source: "let discount = fn(price) { price * 9 / 10 };"},
+		Prelude{Name: "helpers.mky", Source: "let discountAll = fn(prices) { map(prices, discount) };"}, // 前のプレリュードと標準のプレリュードを使う
+	)
+	if err != nil {
+		t.Fatalf("NewEnvironmentWithPreludes returned error: %v", err)
+	}
+
+	program := parser.New(lexer.New("reduce(discountAll([100, 200]), 0, fn(a, b) { a + b })")).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 270)
+
+	tests := []struct {
+		prelude  Prelude
+		expected string
+	}{
+		{Prelude{Name: "rules.mky", Source: "let x 5;"}, "rules.mky:1:7: expected next token to be =, got INT instead"},
+		{Prelude{Name: "rules.mky", Source: "let x = nope;"}, "rules.mky: identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewEnvironmentWithPreludes(tt.prelude)
+		if err == nil {
+			t.Errorf("expected error %q, got nil", tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestEvalReadOnlyEnvironment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // int か、エラーの時はメッセージの string
+	}{
+		{"price * 2", 240},
+		{"let f = fn(x) { let y = x + 1; y }; f(price)", "cannot bind f: environment is read-only"},
+		{"fn(x) { let y = x + 1; y }(price)", 121}, // 関数の中では束縛できる
+		{"let price = 0", "cannot bind price: environment is read-only"},
+		{"price++", "cannot assign to price: environment is read-only"},
+		{"fn() { --price }()", "cannot assign to price: environment is read-only"},
+		{"fn() { let n = 0; for (let i = 0; i < 3; i++) { n++ } n }()", 3}, // ループ変数も for 文の環境に束縛される
+		{"for (let i = 0; i < 3; i++) { price++ }", "cannot assign to price: environment is read-only"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewReadOnlyEnvironment(map[string]object.Object{
+			"price": &object.Integer{Value: 120},
+		})
+		program := testParseProgram(tt.input)
+		evaluated := Eval(program, env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+
+		if obj, _ := env.Get("price"); obj.Inspect() != "120" {
+			t.Errorf("%q changed price to %s", tt.input, obj.Inspect())
+		}
+	}
+}
+
+// 入力を字句解析・構文解析して、新しい環境で評価した結果を返す
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote(1.5))`, `1.5`},
+		{`quote(f(unquote(1 + 1)))`, `f(2)`},
+		// AST ノードに戻せない値の時は unquote の呼び出しがそのまま残る
+		{`quote(unquote(fn(x) { x }))`, `unquote(fn(x) x)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros returned an error: %s", err.Inspect())
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q",
+				expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedStack   []string
+	}{
+		{"let m = macro() { 1 }; m()", "macro must return a quoted node, got INTEGER", []string{"m"}},
+		{"let m = macro(x) { x + 1 }; let f = fn() { m(2) }", "type mismatch: QUOTE + INTEGER", []string{"m"}},
+		// マクロの本体から呼び出したマクロは展開されない
+		{"let a = macro() { quote(1) }; let b = macro() { a() }; b()", "macro cannot be called at runtime", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("no error returned for %q", tt.input)
+			continue
+		}
+
+		if err.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, err.Message)
+		}
+		stack := []string{}
+		for _, f := range err.Stack {
+			stack = append(stack, f.Function)
+		}
+		if strings.Join(stack, ",") != strings.Join(tt.expectedStack, ",") {
+			t.Errorf("wrong stack for %q. expected=%v, got=%v", tt.input, tt.expectedStack, stack)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,48 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// src を一つの式として構文解析して、env の中で評価する。Monkey を条件式や計算式の言語として組み込む時に使う。
+// 構文解析のエラーは *parser.ParseError として、評価中のエラーは *object.Error として返す
+func EvalExpr(src string, env *object.Environment) (object.Object, error) {
+	exp, err := parser.ParseExpression(src)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Eval(exp, env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+	return result, nil
+}
+
+// リテラルを値として解釈する関数を、parser.Parser.RegisterLiteral に登録できる形にする。
+// 返せる値は unquote で木に戻せる値と同じで、整数、浮動小数点数、文字列、真偽値と quote した式。
+// 値は構文解析の時に一度だけ作られて、リテラルの位置に埋め込まれる
+func ObjectLiteral(handler func(literal string) (object.Object, error)) parser.LiteralHandler {
+	return func(literal string) (ast.Expression, error) {
+		obj, err := handler(literal)
+		if err != nil {
+			return nil, err
+		}
+		if errObj, ok := obj.(*object.Error); ok {
+			return nil, errObj
+		}
+
+		if obj == nil {
+			return nil, fmt.Errorf("no value for literal")
+		}
+
+		exp, ok := convertObjectToASTNode(obj, nil).(ast.Expression)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be used as a literal value", obj.Type())
+		}
+		return exp, nil
+	}
+}
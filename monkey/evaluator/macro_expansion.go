@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// プログラムのトップレベルにある let <名前> = macro(...) {...}; を取り除いて、マクロを env に束縛する。
+// 関数の中などトップレベル以外でのマクロの定義は扱わない
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	// 後ろから取り除かないと、取り除くたびに添字がずれてしまう
+	for i := len(definitions) - 1; i >= 0; i = i - 1 {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// env に束縛されたマクロの呼び出しを、引数を評価せずに Quote として渡してマクロの本体を評価した結果で置き換える。
+// マクロは quote(...) の結果を返さなければならない。それ以外の値を返した時や本体の評価がエラーになった時は、
+// 残りの呼び出しを展開せずに、マクロの呼び出しをスタックに記録したエラーを返す
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var expandErr *object.Error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if expandErr != nil {
+			return node
+		}
+
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+
+		switch evaluated := evaluated.(type) {
+		case *object.Quote:
+			return evaluated.Node
+		case *object.Error:
+			expandErr = evaluated
+		default:
+			expandErr = newError("macro must return a quoted node, got %s", evaluated.Type())
+		}
+		expandErr.Stack = append(expandErr.Stack, object.StackFrame{Function: callExpression.Function.String(), Pos: callExpression.Token.Pos()})
+		return node
+	})
+
+	if expandErr != nil {
+		return nil, expandErr
+	}
+	return expanded, nil
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		if paramIdx < len(args) {
+			extended.Set(param.Value, args[paramIdx])
+		} else {
+			extended.Set(param.Value, NULL) // 関数と同じく、引数が足りない仮引数は null に束縛する
+		}
+	}
+
+	return extended
+}
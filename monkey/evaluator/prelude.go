@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+	_ "embed"
+	"fmt"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+)
+
+// 標準ライブラリのうち Monkey で書いた部分。バイナリに埋め込むので、実行する時にほかのファイルはいらない
+//
+//go:embed prelude.mky
+var preludeSource string
+
+// 環境を作る時に、ユーザのプログラムより先に評価するソースコード
+type Prelude struct {
+	Name   string // エラーメッセージでソースコードを示す名前。たとえばファイル名
+	Source string
+}
+
+// プレリュードを評価した新しい環境を返す。map, filter, reduce などの関数が束縛されている
+func NewEnvironment() *object.Environment {
+	env := object.NewEnvironment()
+	if err := LoadPrelude(env); err != nil {
+		panic(err.Error()) // 埋め込んだソースコードが間違っている
+	}
+	return env
+}
+
+// 標準のプレリュードに続けて、組み込む側が用意した preludes を順に評価した新しい環境を返す。
+// Monkey を組み込んだ製品が、すべてのスクリプトで使える領域ごとの関数を用意するために使う。
+// 後のプレリュードは、前のプレリュードで束縛した名前を使ったり束縛し直したりできる。
+// 構文解析か評価に失敗したプレリュードがある時は、そのエラーを返す
+func NewEnvironmentWithPreludes(preludes ...Prelude) (*object.Environment, error) {
+	env := NewEnvironment()
+	for _, prelude := range preludes {
+		if err := prelude.Load(env); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// 標準のプレリュードを env で評価して、その関数を env に束縛する
+func LoadPrelude(env *object.Environment) error {
+	return Prelude{Name: "prelude.mky", Source: preludeSource}.Load(env)
+}
+
+// プレリュードを env で評価する。エラーには "名前:行:列: " か "名前: " をつける
+func (p Prelude) Load(env *object.Environment) error {
+	ps := parser.New(lexer.New(p.Source))
+	program := ps.ParseProgram()
+	if errors := ps.ErrorList(); len(errors) != 0 {
+		msgs := []string{}
+		for _, err := range errors {
+			msgs = append(msgs, p.Name+":"+err.Error())
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+	}
+
+	if errObj, ok := Eval(program, env).(*object.Error); ok {
+		return fmt.Errorf("%s: %s", p.Name, errObj.Message)
+	}
+	return nil
+}
@@ -1,34 +1,134 @@
 package lexer
 
-import "monkey/token"
+import (
+	"io"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 字句解析のエラー。エラーが見つかった位置とメッセージを持つ
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Lexer の動作を切り替えるフラグ
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota // コメントを読み飛ばさずに token.COMMENT として返す。フォーマッタなどのツール向け
+)
+
+// NewFromReader で生成した Lexer が、一度に読み込むバイト数
+const readChunkSize = 4096
 
 type Lexer struct {
 	input        string
-	position     int  //入力における現在の位置(現在の文字を指し示す)
-	readPosition int  // これから読み込む位置(現在の文字の次)
-	ch           byte // 現在検査中の文字
+	reader       io.Reader // NewFromReader で生成した時の入力。読み終えたら nil にする
+	buf          []byte    // reader から読み込む時に使い回すバッファ
+	mode         Mode
+	position     int      //入力における現在の位置(現在の文字を指し示す)。位置はバイト単位で、列は文字(rune)単位で数える
+	readPosition int      // これから読み込む位置(現在の文字の次)
+	ch           rune     // 現在検査中の文字
+	line         int      // 現在検査中の文字がある行
+	column       int      // 現在検査中の文字がある列
+	errors       []*Error // 字句解析中に見つかったエラーの情報を保持するための配列
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithMode(input, 0)
+}
+
+// mode で動作を切り替えた Lexer を生成する
+func NewWithMode(input string, mode Mode) *Lexer {
+	l := &Lexer{input: input, mode: mode, line: 1, errors: []*Error{}}
 	l.readChar()
 	return l
 }
 
+// r から少しづつ読み込みながら字句解析する Lexer を生成する。
+// 入力全体をメモリに読み込まないので、大きなファイルやパイプからの入力を字句解析する時に使う
+func NewFromReader(r io.Reader) *Lexer {
+	return NewFromReaderWithMode(r, 0)
+}
+
+// mode で動作を切り替えた、r から読み込む Lexer を生成する
+func NewFromReaderWithMode(r io.Reader, mode Mode) *Lexer {
+	l := &Lexer{reader: r, buf: make([]byte, readChunkSize), mode: mode, line: 1, errors: []*Error{}}
+	l.readChar()
+	return l
+}
+
+// readPosition の文字が input にまだない時は、reader から読み込んで input の後ろに追加する。
+// 複数バイトの文字が読み込みの境目で分かれないように、その文字のバイトがすべてそろうまで読み込む。
+// 入力の終わりに達していて、その文字がない時は false を返す
+func (l *Lexer) fill() bool {
+	for l.readPosition >= len(l.input) || !utf8.FullRuneInString(l.input[l.readPosition:]) {
+		if l.reader == nil {
+			return l.readPosition < len(l.input) // 入力が文字の途中で終わった時は、残りのバイトを不正な文字として読む
+		}
+
+		n, err := l.reader.Read(l.buf)
+		l.input += string(l.buf[:n])
+		if err != nil {
+			if err != io.EOF { // 読み込めなかった時は、そこで入力が終わったものとして扱う
+				pos := token.Position{Line: l.line, Column: l.column}
+				l.errors = append(l.errors, &Error{Pos: pos, Message: "read error: " + err.Error()})
+			}
+			l.reader = nil
+		}
+	}
+	return true
+}
+
+// 読み終えたトークンの分を input から捨てる。reader から読み込む時に、input が入力全体の大きさまで育たないようにする
+func (l *Lexer) discard() {
+	if l.position == 0 || l.position > len(l.input) {
+		return
+	}
+	l.input = l.input[l.position:]
+	l.readPosition -= l.position
+	l.position = 0
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
+	if l.ch == '\n' { // 改行を読み終えたら、次の文字は次の行の1列目になる
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
+	width := 1
+	if !l.fill() {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:]) // 不正な UTF-8 のバイトは utf8.RuneError の 1 バイトの文字になる
 	}
 	l.position = l.readPosition //現在読んでいる文字を一つすすめる
-	l.readPosition += 1         //次に読む文字を一つすすめる
+	l.readPosition += width     //次に読む文字を一つすすめる
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
+	if l.reader != nil {
+		l.discard()
+	}
+
 	l.skipWhitespace()
+	for l.mode&ScanComments == 0 && l.isCommentStart() { // コメントは空白と同じように読み飛ばす
+		l.readComment()
+		l.skipWhitespace()
+	}
+
+	line, column := l.line, l.column // トークンの先頭の位置を覚えておいて、生成したトークンにセットする
 
 	switch l.ch {
 	case '=':
@@ -41,9 +141,23 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch) //覗き見した先が'='じゃないときはそのままトークンを生成する
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.INCREMENT, Literal: literal}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.DECREMENT, Literal: literal}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -54,13 +168,60 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
+		if l.isCommentStart() { // ScanComments モードの時だけここに来る
+			tok.Type = token.COMMENT
+			tok.Literal = l.readComment()
+			tok.Line, tok.Column = line, column
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.POWER, Literal: literal}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LT_EQ, Literal: literal}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.GT_EQ, Literal: literal}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.AND, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch) // '&' 単体の演算子はない
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OR, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -69,10 +230,32 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '#':
+		if !isLetter(l.peekChar()) && !isDigit(l.peekChar()) {
+			tok = newToken(token.ILLEGAL, l.ch) // '#' 単体の演算子はない
+			break
+		}
+		position := l.position
+		l.readChar()
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		tok.Type, tok.Literal = token.CUSTOM, l.input[position:l.position]
+		tok.Line, tok.Column = line, column
+		return tok
+	case '"':
+		tok.Type = token.STRING
+		tok.Literal = l.readString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -80,21 +263,23 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()          //英文字の部分を切り取って、tokのLiteralフィールドにセット
 			tok.Type = token.LookupIdent(tok.Literal) //token.LookupIdent()を使って、それがキーワードか識別子か判定し、対応するtokenTypeをセットする
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
 // tokenTypeと文字を受け取って、対応するトークンを生成する
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -107,8 +292,9 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// 識別子の文字。ASCII の英字だけでなく、名前 のような Unicode の文字も使える
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
 // Lexerについてのメソッドで、Lexerが現在読んでいる場所が空文字の時には、そのままreadCharを呼び出して、そこをスキップする
@@ -119,23 +305,199 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // Lexerについてのメソッドで、Lexerが現在読んでいる場所が数字のときには、後に続く数字の部分を切り出し、Lexerのinputにセットする
-func (l *Lexer) readNumber() string {
+// 整数部の後に '.' と数字が続く時には小数として読み進めて、token.FLOAT を返す。
+// 1_000_000 のように数字の間に '_' を書いてもよい。'_' はトークンのリテラルに残り、構文解析器が値にする時に取り除く。
+// 10kb や 1.5s のように数値の直後に文字が続く時は、その文字までを一つのトークンとして token.CUSTOM を返す
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+	pos := token.Position{Line: l.line, Column: l.column}
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) { // "1." や "1.foo" の '.' は数値の一部にしない
+		l.readChar() // '.' を読み飛ばす
+		l.readDigits()
+		tokenType = token.FLOAT
+	}
+	l.checkUnderscores(l.input[position:l.position], pos)
+
+	if isLetter(l.ch) {
+		for isLetter(l.ch) {
+			l.readChar()
+		}
+		tokenType = token.CUSTOM
+	}
+	return tokenType, l.input[position:l.position]
+}
+
+// 数字と '_' を読み進める。'_' の位置が正しいかどうかは、数値全体を読んでから checkUnderscores で確かめる
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+// 数値リテラルの '_' は、数字と数字の間に一つずつしか書けない。最初に見つかった間違った位置の '_' をエラーにする。
+// number は数値の部分だけの文字列で、pos はその先頭の位置
+func (l *Lexer) checkUnderscores(number string, pos token.Position) {
+	for i := 1; i < len(number); i++ { // 数値は数字で始まるので、先頭は '_' ではない
+		if number[i] != '_' {
+			continue
+		}
+
+		var msg string
+		switch {
+		case i == len(number)-1:
+			msg = "trailing underscore in number literal "
+		case number[i+1] == '_':
+			msg = "consecutive underscores in number literal "
+		case !isDigit(rune(number[i-1])) || !isDigit(rune(number[i+1])):
+			msg = "underscore must be between digits in number literal "
+		default:
+			continue
+		}
+
+		pos.Column += i // 数値は ASCII の文字だけなので、バイトの位置がそのまま列になる
+		l.errors = append(l.errors, &Error{Pos: pos, Message: msg + number})
+		return
+	}
+}
+
+// 数値リテラルの数字。strconv で値に変換できる ASCII の数字だけを数字として扱う
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
 // Lexerが現在読んでいる文字の一つ先の文字を「覗き見」する
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if !l.fill() {
 		return 0
 	} else {
-		return l.input[l.readPosition] //現在読んでいる文字の一つ先の文字を返す
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:]) //現在読んでいる文字の一つ先の文字を返す
+		return ch
+	}
+}
+
+// '"' から次の '"' までを文字列として切り出し、エスケープシーケンスを置き換えた値を返す。
+// 閉じる '"' がないまま入力が終わった時にはエラーを追加して、そこまでを文字列とする
+func (l *Lexer) readString() string {
+	var out strings.Builder
+	pos := token.Position{Line: l.line, Column: l.column} // エラーの位置には開始の '"' の位置を使う
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String()
+		case 0:
+			l.errors = append(l.errors, &Error{Pos: pos, Message: "unterminated string literal"})
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// '\\' に続くエスケープシーケンスを読んで、表す文字を out に書き込む。
+// 使えるのは \n, \t, \", \\ と、16進数で符号位置を書く \u{XXXX} だけで、それ以外はエラーにして読み飛ばす。
+// 読み終えた時には、エスケープシーケンスの最後の文字を読んでいる
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := token.Position{Line: l.line, Column: l.column} // エラーの位置には '\\' の位置を使う
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case '"':
+		out.WriteRune('"')
+	case '\\':
+		out.WriteRune('\\')
+	case 'u':
+		l.readUnicodeEscape(out, pos)
+	case 0:
+		// 入力が終わったことは readString がエラーにする
+	default:
+		l.errors = append(l.errors, &Error{Pos: pos, Message: "invalid escape sequence \\" + string(l.ch)})
 	}
 }
+
+// \u に続く {XXXX} を読む。'{' と '}' の間には 1 から 6 桁の16進数で、Unicode の符号位置を書く
+func (l *Lexer) readUnicodeEscape(out *strings.Builder, pos token.Position) {
+	if l.peekChar() != '{' {
+		l.errors = append(l.errors, &Error{Pos: pos, Message: "invalid escape sequence \\u: expected '{'"})
+		return
+	}
+	l.readChar()
+
+	digits := ""
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		digits += string(l.ch)
+	}
+	if l.peekChar() != '}' { // 閉じていない時は、16進数の後の文字から文字列の続きとして読む
+		l.errors = append(l.errors, &Error{Pos: pos, Message: "unterminated escape sequence \\u{" + digits})
+		return
+	}
+	l.readChar()
+
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+		l.errors = append(l.errors, &Error{Pos: pos, Message: "invalid unicode code point \\u{" + digits + "}"})
+		return
+	}
+	out.WriteRune(rune(code))
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// Lexer が現在読んでいる場所が "//" か "/*" で始まるコメントの先頭かどうか判定する
+func (l *Lexer) isCommentStart() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// コメントを読み進めて、区切りの文字も含めたコメント全体を返す。"//" は行末まで、"/*" は "*/" までがコメントになる
+func (l *Lexer) readComment() string {
+	position := l.position
+	pos := token.Position{Line: l.line, Column: l.column}
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return l.input[position:l.position]
+	}
+
+	l.readChar() // '/' を読み飛ばして '*' に進む
+	for {
+		l.readChar()
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			l.readChar() // "*/" の次の文字に進む
+			break
+		}
+		if l.ch == 0 {
+			l.errors = append(l.errors, &Error{Pos: pos, Message: "unterminated block comment"})
+			break
+		}
+	}
+	return l.input[position:l.position]
+}
+
+// Lexer が保持しているエラー情報を "行:列: メッセージ" の形の文字列で返す
+func (l *Lexer) Errors() []string {
+	msgs := []string{}
+	for _, err := range l.errors {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// Lexer が保持しているエラー情報をそのまま返す
+func (l *Lexer) ErrorList() []*Error {
+	return l.errors
+}
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"monkey/token"
 )
@@ -15,7 +19,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -26,7 +30,19 @@ func TestNextToken(t *testing.T) {
 
 	10 == 10;
 	10 != 9;
-
+	"foobar"
+	"foo bar"
+	[1, 2];
+	1 <= 2 >= 3;
+	true && false || true;
+	& |
+	10 % 3;
+	3.14 1.foo
+	for
+	2 ** 3;
+	i++ --i
+	{"foo": "bar"}
+	macro(x, y) { x + y; };
 	`
 
 	tests := []struct {
@@ -106,6 +122,63 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.LT_EQ, "<="},
+		{token.INT, "2"},
+		{token.GT_EQ, ">="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.TRUE, "true"},
+		{token.AND, "&&"},
+		{token.FALSE, "false"},
+		{token.OR, "||"},
+		{token.TRUE, "true"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.FLOAT, "3.14"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.FOR, "for"},
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "i"},
+		{token.INCREMENT, "++"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "i"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -125,3 +198,467 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestUnterminatedString(t *testing.T) {
+	input := `"foo`
+
+	l := New(input)
+
+	tok := l.NextToken()
+	if tok.Type != token.STRING {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.STRING, tok.Type)
+	}
+	if tok.Literal != "foo" {
+		t.Fatalf("literal wrong. expected=%q, got=%q", "foo", tok.Literal)
+	}
+
+	tok = l.NextToken()
+	if tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("lexer has %d errors, expected 1", len(errors))
+	}
+	if errors[0] != "1:1: unterminated string literal" {
+		t.Errorf("wrong error. expected=%q, got=%q",
+			"1:1: unterminated string literal", errors[0])
+	}
+
+	err := l.ErrorList()[0]
+	if err.Pos != (token.Position{Line: 1, Column: 1}) {
+		t.Errorf("err.Pos wrong. expected=1:1, got=%s", err.Pos)
+	}
+	if err.Message != "unterminated string literal" {
+		t.Errorf("err.Message wrong. got=%q", err.Message)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb"`, "a\tb"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"C:\\monkey"`, `C:\monkey`},
+		{`"\u{41}\u{3042}\u{1F600}"`, "Aあ😀"},
+		{`"\u{0061}bc"`, "abc"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("literal wrong for %s. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("unexpected errors for %s: %v", tt.input, l.Errors())
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("expected EOF after %s, got=%q", tt.input, next.Type)
+		}
+	}
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"a\qb"`, "ab", "1:3: invalid escape sequence \\q"},
+		{`x = "ok\u41"`, "ok41", "1:8: invalid escape sequence \\u: expected '{'"},
+		{`"\u{41"`, "", "1:2: unterminated escape sequence \\u{41"},
+		{`"\u{}"`, "", "1:2: invalid unicode code point \\u{}"},
+		{`"\u{D800}"`, "", "1:2: invalid unicode code point \\u{D800}"},
+		{`"\u{110000}"`, "", "1:2: invalid unicode code point \\u{110000}"},
+		{`"\u{1234567}"`, "", "1:2: invalid unicode code point \\u{1234567}"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.STRING; tok = l.NextToken() {
+			if tok.Type == token.EOF {
+				t.Fatalf("no string token in %s", tt.input)
+			}
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("literal wrong for %s. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("lexer has %d errors for %s, expected 1: %v", len(errors), tt.input, errors)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %s. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  x == "a b";
+`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.EQ, 2, 5},
+		{token.STRING, 2, 8},
+		{token.SEMICOLON, 2, 13},
+		{token.EOF, 3, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let 名前 = "こんにちは、世界";
+名前 + "!" → ` + "\xff"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "名前", 1, 5},
+		{token.ASSIGN, "=", 1, 8},
+		{token.STRING, "こんにちは、世界", 1, 10},
+		{token.SEMICOLON, ";", 1, 20},
+		{token.IDENT, "名前", 2, 1},
+		{token.PLUS, "+", 2, 4},
+		{token.STRING, "!", 2, 6},
+		{token.ILLEGAL, "→", 2, 10},
+		{token.ILLEGAL, "\uFFFD", 2, 12}, // 不正な UTF-8 のバイト
+		{token.EOF, "", 2, 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestCustomLiterals(t *testing.T) {
+	input := `10kb + 1.5s; #ff00ff # 7 1.x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.CUSTOM, "10kb"},
+		{token.PLUS, "+"},
+		{token.CUSTOM, "1.5s"},
+		{token.SEMICOLON, ";"},
+		{token.CUSTOM, "#ff00ff"},
+		{token.ILLEGAL, "#"},
+		{token.INT, "7"},
+		{token.INT, "1"}, // '.' の後に数字が続かないので、1 は整数のまま
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumberUnderscores(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string // 空文字列の時はエラーにならないことを期待する
+	}{
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"3.141_592", token.FLOAT, "3.141_592", ""},
+		{"1_0.0_1", token.FLOAT, "1_0.0_1", ""},
+		{"1_000kb", token.CUSTOM, "1_000kb", ""},
+		{"x = 100_", token.INT, "100_", "1:8: trailing underscore in number literal 100_"},
+		{"1__000", token.INT, "1__000", "1:2: consecutive underscores in number literal 1__000"},
+		{"1_.5", token.FLOAT, "1_.5", "1:2: underscore must be between digits in number literal 1_.5"},
+		{"1.5_", token.FLOAT, "1.5_", "1:4: trailing underscore in number literal 1.5_"},
+		{"10_kb", token.CUSTOM, "10_kb", "1:3: trailing underscore in number literal 10_"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != tt.expectedType; tok = l.NextToken() {
+			if tok.Type == token.EOF {
+				t.Fatalf("no %s token in %q", tt.expectedType, tt.input)
+			}
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("literal wrong for %q. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("unexpected errors for %q: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// 行コメント
+let x = 5; // 行末のコメント
+/* ブロック
+   コメント */ x / 2 /**/;
+`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %q", l.Errors())
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	input := `// a
+x /* b */`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.COMMENT, "// a", 1, 1},
+		{token.IDENT, "x", 2, 1},
+		{token.COMMENT, "/* b */", 2, 3},
+		{token.EOF, "", 2, 10},
+	}
+
+	l := NewWithMode(input, ScanComments)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := `x /* never closed`
+
+	l := New(input)
+
+	if tok := l.NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.IDENT, tok.Type)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("lexer has %d errors, expected 1", len(errors))
+	}
+	if errors[0] != "1:3: unterminated block comment" {
+		t.Errorf("wrong error. expected=%q, got=%q",
+			"1:3: unterminated block comment", errors[0])
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	inputs := []string{
+		`let five = 5;
+let add = fn(x, y) { x + y; };
+!-/*5; 5 < 10 >= 2 ** 3;
+"foo bar" // comment
+/* block
+comment */ [1, 2.5]; {"a": 1}
+x++ && y-- || z != 10 == 10
+let 名前 = "こんにちは、世界"; 名前 → "\xff"`,
+		`"tab\there" "\u{540D}\u{524D}" "bad \q escape"`,
+		`"never closed`,
+		"名前\xe5\x90", // 文字の途中で入力が終わる
+		"",
+	}
+
+	readers := map[string]func(string) io.Reader{
+		"whole":    func(s string) io.Reader { return strings.NewReader(s) },
+		"one byte": func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"half":     func(s string) io.Reader { return iotest.HalfReader(strings.NewReader(s)) },
+	}
+
+	for _, input := range inputs {
+		for name, newReader := range readers {
+			expected := New(input)
+			l := NewFromReader(newReader(input))
+
+			for i := 0; ; i++ {
+				want := expected.NextToken()
+				got := l.NextToken()
+				if got != want {
+					t.Fatalf("%s reader, token %d of %q wrong. expected=%+v, got=%+v",
+						name, i, input, want, got)
+				}
+				if want.Type == token.EOF {
+					break
+				}
+			}
+
+			if strings.Join(l.Errors(), "\n") != strings.Join(expected.Errors(), "\n") {
+				t.Errorf("%s reader, errors of %q wrong. expected=%q, got=%q",
+					name, input, expected.Errors(), l.Errors())
+			}
+		}
+	}
+}
+
+func TestNewFromReaderDiscardsConsumedInput(t *testing.T) {
+	// 読み込むバッファの境界をまたぐトークンがあるように、何回分も読み込む大きさの入力にする
+	lines := 3 * readChunkSize / 10
+	input := strings.Repeat("let identifier = 12345;\n", lines)
+
+	l := NewFromReader(strings.NewReader(input))
+
+	count := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if len(l.input) > 2*readChunkSize {
+			t.Fatalf("lexer keeps %d bytes of input", len(l.input))
+		}
+		count++
+	}
+
+	if count != 5*lines {
+		t.Errorf("wrong number of tokens. expected=%d, got=%d", 5*lines, count)
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %v", l.Errors())
+	}
+}
+
+func TestNewFromReaderReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("boom")))
+
+	l := NewFromReader(r)
+
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+
+	msgs := l.Errors()
+	if len(msgs) != 1 {
+		t.Fatalf("lexer has %d errors, expected 1", len(msgs))
+	}
+	if msgs[0] != "1:6: read error: boom" {
+		t.Errorf("wrong error. expected=%q, got=%q", "1:6: read error: boom", msgs[0])
+	}
+}
@@ -1,13 +1,57 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"monkey/optimizer"
 	"monkey/repl"
+	"monkey/version"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	o0 := flag.Bool("O0", false, "disable optimizations (default)")
+	o1 := flag.Bool("O1", false, "fold constant expressions")
+	o2 := flag.Bool("O2", false, "also inline small functions and eliminate dead code")
+	dumpPasses := flag.Bool("dump-passes", false, "print the program to stderr after each optimization pass")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		printVersion()
+		return
+	}
+
+	// 複数指定された時は、一番強いものを使う
+	newOptimizer := func() *optimizer.Optimizer {
+		level := optimizer.O0
+		switch {
+		case *o2:
+			level = optimizer.O2
+		case *o1:
+			level = optimizer.O1
+		case *o0:
+			level = optimizer.O0
+		}
+		opt := optimizer.New(level)
+		if *dumpPasses {
+			opt.SetDump(os.Stderr)
+		}
+		return opt
+	}
+
+	if flag.Arg(0) == "run" {
+		flag.CommandLine.Parse(flag.Args()[1:]) // run の後ろにもフラグを書けるようにする
+		if flag.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+		os.Exit(runFile(flag.Arg(0), newOptimizer()))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +59,33 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey programming language\n",
 		user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+
+	repl.StartWithOptimizer(os.Stdin, os.Stdout, newOptimizer())
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: monkey [flags]            start the REPL\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       monkey [flags] run FILE   run a Monkey source file\n")
+	flag.PrintDefaults()
+}
+
+// ファイルを読み込んで実行し、終了コードを返す
+func runFile(filename string, opt *optimizer.Optimizer) int {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !repl.Run(filename, string(src), os.Stdout, os.Stderr, opt) {
+		return 1
+	}
+	return 0
+}
+
+// バージョン、git のコミット、Go のバージョン、使える機能を表示する。コミットはビルド情報に埋め込まれている時だけ表示される
+func printVersion() {
+	fmt.Printf("monkey %s\n", version.Version)
+	fmt.Printf("commit: %s\n", version.Commit())
+	fmt.Printf("go: %s\n", version.GoVersion())
+	fmt.Printf("features: %s\n", strings.Join(version.EnabledFeatures(), ", "))
 }
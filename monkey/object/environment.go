@@ -0,0 +1,97 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// 識別子の名前とそれに束縛された値を関連づける環境
+type Environment struct {
+	store    map[string]Object
+	outer    *Environment // 外側の環境。一番外側の環境では nil
+	output   io.Writer    // puts などの出力先。nil の時は外側の環境の出力先を使う
+	readOnly bool         // true の時は束縛の追加も書き換えもできない
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// outer を外側の環境として持つ、新しい環境を生成する。関数本体はこの環境の中で評価される
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// data の名前と値の組を束縛した、読み取り専用の環境を生成する。
+// 利用者が書いた条件式などを、与えたデータを書き換えずに評価したい時に使う。data はコピーするので、後から変更しても影響しない。
+// 関数の本体はこの環境を外側に持つ新しい環境で評価されるので、関数の中の let や仮引数はこれまで通り使える
+func NewReadOnlyEnvironment(data map[string]Object) *Environment {
+	env := NewEnvironment()
+	for name, val := range data {
+		env.store[name] = val
+	}
+	env.readOnly = true
+	return env
+}
+
+// 読み取り専用の環境かどうか
+func (e *Environment) ReadOnly() bool {
+	return e.readOnly
+}
+
+// 名前に束縛された値を返す。この環境で見つからない時には外側の環境を順にたどって探す
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// puts などのプログラムの出力の書き出し先を返す。この環境で設定されていない時は外側の環境の出力先を使い、
+// どこにも設定されていない時は標準出力になる
+func (e *Environment) Output() io.Writer {
+	if e.output != nil {
+		return e.output
+	}
+	if e.outer != nil {
+		return e.outer.Output()
+	}
+	return os.Stdout
+}
+
+// プログラムの出力の書き出し先を設定する。内側の環境はこの設定を引き継ぐ
+func (e *Environment) SetOutput(w io.Writer) {
+	e.output = w
+}
+
+// 名前がすでに束縛されている環境を内側から順にたどって探し、その環境の束縛を val で置き換える。
+// Set と違って新しい束縛は作らないので、どの環境にも束縛されていない時は false を返す。
+// 束縛が読み取り専用の環境にある時も、書き換えずに false を返す
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		if e.readOnly {
+			return false
+		}
+		e.store[name] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+// 名前に値を束縛する。外側の環境には影響しない。
+// 読み取り専用の環境の時は束縛せずに *Error を返す
+func (e *Environment) Set(name string, val Object) Object {
+	if e.readOnly {
+		return &Error{Message: fmt.Sprintf("cannot bind %s: environment is read-only", name)}
+	}
+	e.store[name] = val
+	return val
+}
@@ -0,0 +1,176 @@
+package object
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestEnvironmentGetSet(t *testing.T) {
+	env := NewEnvironment()
+
+	if _, ok := env.Get("x"); ok {
+		t.Fatalf("env.Get(\"x\") found a value in an empty environment")
+	}
+
+	env.Set("x", &Integer{Value: 5})
+
+	obj, ok := env.Get("x")
+	if !ok {
+		t.Fatalf("env.Get(\"x\") not found")
+	}
+	if obj.Inspect() != "5" {
+		t.Errorf("env.Get(\"x\") wrong. expected=%q, got=%q", "5", obj.Inspect())
+	}
+}
+
+func TestEnclosedEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	outer.Set("y", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("y", &Integer{Value: 20}) // 外側の y を内側の環境で覆い隠す
+	inner.Set("z", &Integer{Value: 30})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected string
+		found    bool
+	}{
+		{inner, "x", "1", true}, // 外側の環境までたどって見つかる
+		{inner, "y", "20", true},
+		{inner, "z", "30", true},
+		{outer, "y", "2", true}, // 内側での Set は外側に影響しない
+		{outer, "z", "", false},
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if ok != tt.found {
+			t.Errorf("env.Get(%q) found=%t, expected=%t", tt.name, ok, tt.found)
+			continue
+		}
+		if ok && obj.Inspect() != tt.expected {
+			t.Errorf("env.Get(%q) wrong. expected=%q, got=%q",
+				tt.name, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	outer.Set("y", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("y", &Integer{Value: 20})
+
+	if !inner.Assign("x", &Integer{Value: 10}) {
+		t.Fatalf("inner.Assign(%q) returned false", "x")
+	}
+	if !inner.Assign("y", &Integer{Value: 200}) {
+		t.Fatalf("inner.Assign(%q) returned false", "y")
+	}
+	if inner.Assign("z", &Integer{Value: 30}) {
+		t.Errorf("inner.Assign(%q) returned true for an unbound name", "z")
+	}
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected string
+	}{
+		{outer, "x", "10"},  // 束縛されている外側の環境が書き換わる
+		{outer, "y", "2"},   // 内側で覆い隠されている束縛は書き換わらない
+		{inner, "y", "200"}, // 一番内側の束縛が書き換わる
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if !ok {
+			t.Errorf("env.Get(%q) not found", tt.name)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("env.Get(%q) wrong. expected=%q, got=%q",
+				tt.name, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, ok := inner.Get("z"); ok {
+		t.Errorf("Assign created a new binding for %q", "z")
+	}
+}
+
+func TestReadOnlyEnvironment(t *testing.T) {
+	data := map[string]Object{"x": &Integer{Value: 1}}
+	env := NewReadOnlyEnvironment(data)
+	data["y"] = &Integer{Value: 2} // 生成した後の変更は環境に影響しない
+
+	if !env.ReadOnly() {
+		t.Fatalf("env.ReadOnly() returned false")
+	}
+	if obj, ok := env.Get("x"); !ok || obj.Inspect() != "1" {
+		t.Fatalf("env.Get(%q) wrong. got=%v, %t", "x", obj, ok)
+	}
+	if _, ok := env.Get("y"); ok {
+		t.Errorf("env.Get(%q) found a value added after creation", "y")
+	}
+
+	result := env.Set("z", &Integer{Value: 3})
+	errObj, ok := result.(*Error)
+	if !ok {
+		t.Fatalf("env.Set did not return *Error. got=%T (%+v)", result, result)
+	}
+	if errObj.Message != "cannot bind z: environment is read-only" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if _, ok := env.Get("z"); ok {
+		t.Errorf("env.Set added a binding to a read-only environment")
+	}
+
+	if env.Assign("x", &Integer{Value: 10}) {
+		t.Errorf("env.Assign returned true on a read-only environment")
+	}
+	if obj, _ := env.Get("x"); obj.Inspect() != "1" {
+		t.Errorf("env.Assign changed a read-only binding. got=%s", obj.Inspect())
+	}
+
+	// 内側の環境には束縛を追加できて、外側の読み取り専用の束縛は書き換えられない
+	inner := NewEnclosedEnvironment(env)
+	if inner.ReadOnly() {
+		t.Errorf("enclosed environment is read-only")
+	}
+	inner.Set("z", &Integer{Value: 3})
+	if _, ok := inner.Get("z"); !ok {
+		t.Errorf("inner.Set did not add a binding")
+	}
+	if inner.Assign("x", &Integer{Value: 10}) {
+		t.Errorf("inner.Assign changed a binding in the read-only outer environment")
+	}
+}
+
+func TestEnvironmentOutput(t *testing.T) {
+	outer := NewEnvironment()
+	inner := NewEnclosedEnvironment(outer)
+
+	if outer.Output() != os.Stdout || inner.Output() != os.Stdout {
+		t.Errorf("default output is not os.Stdout")
+	}
+
+	var outerOut, innerOut bytes.Buffer
+	outer.SetOutput(&outerOut)
+	if inner.Output() != &outerOut {
+		t.Errorf("inner environment does not use the outer output")
+	}
+
+	inner.SetOutput(&innerOut)
+	if inner.Output() != &innerOut {
+		t.Errorf("inner environment does not use its own output")
+	}
+	if outer.Output() != &outerOut {
+		t.Errorf("SetOutput on the inner environment changed the outer output")
+	}
+}
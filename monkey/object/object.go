@@ -0,0 +1,375 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	ARRAY_OBJ        = "ARRAY"
+	BUILTIN_OBJ      = "BUILTIN"
+	HASH_OBJ         = "HASH"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+)
+
+// 評価器が扱うすべての値はこのインターフェースを満たす
+type Object interface {
+	Type() ObjectType
+	Inspect() string // 値をREPLなどで表示するための文字列
+}
+
+// ハッシュのキーとして使える値が返すキー。型と値が同じなら、別々に生成された値でも同じキーになる
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// ハッシュのキーとして使える値が満たすインターフェース
+type Hashable interface {
+	HashKey() HashKey
+}
+
+// 整数の値
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: uint64(i.Value)} }
+
+// 浮動小数点数の値
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// 整数と見分けがつくように、小数部がない時にも ".0" をつけて表示する
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { // 指数表記、Inf、NaN はそのまま
+		s += ".0"
+	}
+	return s
+}
+
+// 文字列の値
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// 文字列の内容から FNV-1a でハッシュ値を計算する
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// 配列の値
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// ハッシュに格納するキーと値の組。Inspect() でキーを表示できるように、キーの値そのものも持っておく
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// ハッシュの値
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// 真偽値の値
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// 値が存在しないことを表す値。ラップする値を持たない
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// 真偽値とnullは値が一つしかないので、毎回生成せずに同じインスタンスを使い回す
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Go の真偽値を、それに対応する TRUE か FALSE にする
+func NativeBool(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// return文で返される値をラップする。評価器はこれを見て、それ以降の文の評価をやめる
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// 評価中に起きたエラーを表す値。評価器はこれを受け取るとそれ以上評価を進めずに、呼び出し元へそのまま返していく
+type Error struct {
+	Message string
+	Stack   []StackFrame // エラーが伝わってきた関数呼び出し。エラーが起きた場所に近い呼び出しが先頭になる
+}
+
+// エラーが伝わってきた関数呼び出しの一つ
+type StackFrame struct {
+	Function string         // 呼び出された関数の式。たとえば "add"
+	Pos      token.Position // 呼び出しの '(' の位置
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+// Go の error として扱えるようにする。Monkey を組み込んだ側にエラーを返す時に使う
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: " + e.Message)
+	for _, f := range e.Stack {
+		out.WriteString("\n\tat " + f.Function + " (" + f.Pos.String() + ")")
+	}
+
+	return out.String()
+}
+
+// 関数の値。仮引数と関数本体のブロック文に加えて、関数が定義された環境を保持する
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment // クロージャとして捕捉した、関数が定義された時点の環境
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// コンパイラが関数リテラルから生成した、VM で実行する関数
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // 仮引数も含めた局所変数の数。呼び出す時にスタックにこれだけの領域を確保する
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// VM で関数リテラルを評価した値。評価器の Function が環境を持つ代わりに、捕捉した自由変数の値を持つ
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object // 自由変数の値。コンパイラが SymbolTable.FreeSymbols に並べた順に並ぶ
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// quote で評価せずに取っておいた AST ノード
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// マクロの値。関数と同じく仮引数と本体と定義された環境を持つが、引数は評価されずに Quote として渡される
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// 組み込み関数の本体。呼び出された環境と評価済みの引数を受け取って、結果の値を返す
+type BuiltinFunction func(env *Environment, args ...Object) Object
+
+// Go の関数で実装された組み込み関数の値
+type Builtin struct {
+	Fn BuiltinFunction
+
+	// help() で表示する説明。Name は組み込み関数の表に登録する時に設定される
+	Name      string
+	Signature string // 呼び出し方。たとえば "push(array, value)"
+	Doc       string
+
+	Spec *BuiltinSpec // 引数と作用の仕様。nil の時は Fn が自分で引数を確かめ、作用はわからないものとして扱われる
+}
+
+// BuiltinSpec.MaxArgs に使うと、引数の数の上限がなくなる
+const VariadicArgs = -1
+
+// 組み込み関数が受け付ける引数の数と型と、呼び出した時に起きる作用。作用は analysis パッケージが純粋さの判定に使う
+type BuiltinSpec struct {
+	MinArgs  int
+	MaxArgs  int            // VariadicArgs の時は上限なし
+	ArgTypes [][]ObjectType // i 番目の引数が受け付ける型の一覧。nil か範囲外の時はどの型でも受け付ける
+
+	IO               bool // 環境の出力先に書き出すなど、外から観測できる入出力をする
+	Nondeterministic bool // 同じ引数でも結果が変わりうる
+}
+
+// 引数が仕様を満たしているかを確かめて、満たしていない時は name を先頭につけたエラーを返す。
+// どの組み込み関数でも同じ形のメッセージになるように、引数の確認はここにまとめる
+func (s *BuiltinSpec) Check(name string, args []Object) *Error {
+	if len(args) < s.MinArgs || (s.MaxArgs != VariadicArgs && len(args) > s.MaxArgs) {
+		return &Error{Message: fmt.Sprintf("%s: expected %s, got %d", name, s.arity(), len(args))}
+	}
+
+	for i, arg := range args {
+		if i >= len(s.ArgTypes) || s.ArgTypes[i] == nil {
+			continue
+		}
+
+		accepted := false
+		for _, t := range s.ArgTypes[i] {
+			if arg.Type() == t {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			types := make([]string, len(s.ArgTypes[i]))
+			for j, t := range s.ArgTypes[i] {
+				types[j] = string(t)
+			}
+			return &Error{Message: fmt.Sprintf("%s: argument %d must be %s, got %s",
+				name, i+1, strings.Join(types, " or "), arg.Type())}
+		}
+	}
+
+	return nil
+}
+
+// 受け付ける引数の数を "1 argument" や "1 to 2 arguments" の形で返す
+func (s *BuiltinSpec) arity() string {
+	switch {
+	case s.MaxArgs == VariadicArgs:
+		return "at least " + pluralArguments(s.MinArgs)
+	case s.MinArgs == s.MaxArgs:
+		return pluralArguments(s.MinArgs)
+	default:
+		return fmt.Sprintf("%d to %s", s.MinArgs, pluralArguments(s.MaxArgs))
+	}
+}
+
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
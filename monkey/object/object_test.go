@@ -0,0 +1,156 @@
+package object
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		obj          Object
+		expectedType ObjectType
+		expected     string
+	}{
+		{&Integer{Value: 5}, INTEGER_OBJ, "5"},
+		{&Integer{Value: -10}, INTEGER_OBJ, "-10"},
+		{&Float{Value: 3.14}, FLOAT_OBJ, "3.14"},
+		{&Float{Value: 2}, FLOAT_OBJ, "2.0"},
+		{&Float{Value: -0.5}, FLOAT_OBJ, "-0.5"},
+		{&Float{Value: 1e21}, FLOAT_OBJ, "1e+21"},
+		{&Boolean{Value: true}, BOOLEAN_OBJ, "true"},
+		{&Boolean{Value: false}, BOOLEAN_OBJ, "false"},
+		{&Null{}, NULL_OBJ, "null"},
+		{&String{Value: "hello world"}, STRING_OBJ, "hello world"},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "two"}, &Boolean{Value: true}}}, ARRAY_OBJ, "[1, two, true]"},
+		{&Array{}, ARRAY_OBJ, "[]"},
+		{&Hash{Pairs: map[HashKey]HashPair{
+			(&String{Value: "name"}).HashKey(): {Key: &String{Value: "name"}, Value: &String{Value: "monkey"}},
+		}}, HASH_OBJ, "{name: monkey}"},
+		{&Hash{}, HASH_OBJ, "{}"},
+		{&Quote{Node: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "foobar"}, Value: "foobar"}}, QUOTE_OBJ, "QUOTE(foobar)"},
+		{&Macro{Parameters: []*ast.Identifier{{Value: "x"}}, Body: &ast.BlockStatement{}}, MACRO_OBJ, "macro(x) {\n\n}"},
+		{&Builtin{Fn: func(env *Environment, args ...Object) Object { return nil }}, BUILTIN_OBJ, "builtin function"},
+		{&ReturnValue{Value: &Integer{Value: 1}}, RETURN_VALUE_OBJ, "1"},
+		{&Error{Message: "type mismatch: INTEGER + BOOLEAN"}, ERROR_OBJ,
+			"ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{&Error{Message: "identifier not found: x", Stack: []StackFrame{
+			{Function: "inner", Pos: token.Position{Line: 2, Column: 10}},
+			{Function: "outer", Pos: token.Position{Line: 5, Column: 6}},
+		}}, ERROR_OBJ, "ERROR: identifier not found: x\n\tat inner (2:10)\n\tat outer (5:6)"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Type() != tt.expectedType {
+			t.Errorf("obj.Type() wrong. expected=%q, got=%q",
+				tt.expectedType, tt.obj.Type())
+		}
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("obj.Inspect() wrong. expected=%q, got=%q",
+				tt.expected, tt.obj.Inspect())
+		}
+	}
+}
+
+func TestBuiltinSpecCheck(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := &String{Value: "a"}
+
+	tests := []struct {
+		spec     BuiltinSpec
+		args     []Object
+		expected string // 空文字列の時はエラーにならないことを期待する
+	}{
+		{BuiltinSpec{MinArgs: 1, MaxArgs: 1}, []Object{one}, ""},
+		{BuiltinSpec{MinArgs: 1, MaxArgs: 1}, []Object{}, "f: expected 1 argument, got 0"},
+		{BuiltinSpec{MinArgs: 2, MaxArgs: 2}, []Object{one}, "f: expected 2 arguments, got 1"},
+		{BuiltinSpec{MinArgs: 0, MaxArgs: 0}, []Object{one}, "f: expected 0 arguments, got 1"},
+		{BuiltinSpec{MinArgs: 1, MaxArgs: 2}, []Object{one, one, one}, "f: expected 1 to 2 arguments, got 3"},
+		{BuiltinSpec{MinArgs: 1, MaxArgs: VariadicArgs}, []Object{one, one, one}, ""},
+		{BuiltinSpec{MinArgs: 1, MaxArgs: VariadicArgs}, []Object{}, "f: expected at least 1 argument, got 0"},
+		{BuiltinSpec{MinArgs: 2, MaxArgs: 2, ArgTypes: [][]ObjectType{{STRING_OBJ}}}, []Object{str, one}, ""},
+		{BuiltinSpec{MinArgs: 2, MaxArgs: 2, ArgTypes: [][]ObjectType{nil, {STRING_OBJ}}}, []Object{str, one},
+			"f: argument 2 must be STRING, got INTEGER"},
+		{BuiltinSpec{MinArgs: 1, MaxArgs: 1, ArgTypes: [][]ObjectType{{STRING_OBJ, ARRAY_OBJ}}}, []Object{one},
+			"f: argument 1 must be STRING or ARRAY, got INTEGER"},
+	}
+
+	for i, tt := range tests {
+		err := tt.spec.Check("f", tt.args)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("tests[%d] - unexpected error: %s", i, err.Message)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("tests[%d] - expected error %q, got nil", i, tt.expected)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyType(t *testing.T) {
+	// 値が同じでも型が違えば別のキーになる
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("1 and true have same hash keys")
+	}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integers with same value have different hash keys")
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	fn := &Function{
+		Parameters: []*ast.Identifier{
+			{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+			{Token: token.Token{Type: token.IDENT, Literal: "y"}, Value: "y"},
+		},
+		Body: &ast.BlockStatement{
+			Token: token.Token{Type: token.LBRACE, Literal: "{"},
+			Statements: []ast.Statement{
+				&ast.ExpressionStatement{
+					Token: token.Token{Type: token.IDENT, Literal: "x"},
+					Expression: &ast.Identifier{
+						Token: token.Token{Type: token.IDENT, Literal: "x"},
+						Value: "x",
+					},
+				},
+			},
+		},
+	}
+
+	if fn.Type() != FUNCTION_OBJ {
+		t.Errorf("fn.Type() wrong. expected=%q, got=%q", FUNCTION_OBJ, fn.Type())
+	}
+
+	expected := "fn(x, y) {\nx\n}"
+	if fn.Inspect() != expected {
+		t.Errorf("fn.Inspect() wrong. expected=%q, got=%q", expected, fn.Inspect())
+	}
+}
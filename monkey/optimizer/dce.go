@@ -0,0 +1,69 @@
+package optimizer
+
+import "monkey/ast"
+
+// 実行されない文と、値が使われずに何も起こさない文を取り除く。
+//   - return 文より後ろの文は実行されない
+//   - 最後の文以外で、リテラルだけの式文は値が捨てられるだけで何も起こさない
+//   - 条件が true のリテラルの if 式の else 節は実行されない
+//
+// quote の引数の中は、値として取り出せる木なので書き換えない
+func eliminateDeadCode(program *ast.Program) *ast.Program {
+	quoted := quotedNodes(program)
+
+	modified := ast.Modify(program, func(node ast.Node) ast.Node {
+		if quoted[node] {
+			return node
+		}
+
+		switch node := node.(type) {
+		case *ast.Program:
+			node.Statements = liveStatements(node.Statements)
+
+		case *ast.BlockStatement:
+			node.Statements = liveStatements(node.Statements)
+
+		case *ast.IfExpression:
+			if b, ok := node.Condition.(*ast.Boolean); ok && b.Value {
+				node.Alternative = nil
+			}
+		}
+		return node
+	})
+
+	return modified.(*ast.Program)
+}
+
+// 文の並びから、取り除いてよい文を除いた並びを返す。プログラムとブロックの値は最後の文の値なので、最後の文は残す
+func liveStatements(statements []ast.Statement) []ast.Statement {
+	live := []ast.Statement{}
+
+	for i, s := range statements {
+		last := i == len(statements)-1
+		if !last && isPureExpressionStatement(s) {
+			continue
+		}
+
+		live = append(live, s)
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			break
+		}
+	}
+
+	return live
+}
+
+// 評価しても値ができるだけで、エラーも副作用も起こさない式文かどうか
+func isPureExpressionStatement(s ast.Statement) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	switch es.Expression.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package optimizer
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+)
+
+// 被演算子がすべてリテラルの前置演算子と中置演算子を、評価した結果のリテラルに置き換える。
+// 結果は評価器で計算するので、評価した時と同じ値になる。
+// エラーになる式(0 での割り算など)はそのまま残して、実行した時にエラーになるようにする
+func foldConstants(program *ast.Program) *ast.Program {
+	quoted := quotedNodes(program)
+
+	folded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if quoted[node] {
+			return node
+		}
+
+		switch node := node.(type) {
+		case *ast.PrefixExpression:
+			if isLiteral(node.Right) {
+				return fold(node, node.Token)
+			}
+
+		case *ast.InfixExpression:
+			if isLiteral(node.Left) && isLiteral(node.Right) {
+				return fold(node, startToken(node.Left))
+			}
+		}
+		return node
+	})
+
+	return folded.(*ast.Program)
+}
+
+// quote の引数の中のノードの集合を返す。quote は引数の木そのものを値にするので、その中は書き換えてはいけない
+func quotedNodes(program *ast.Program) map[ast.Node]bool {
+	quoted := map[ast.Node]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "quote" {
+			return true
+		}
+
+		for _, arg := range call.Arguments {
+			ast.Inspect(arg, func(n ast.Node) bool {
+				quoted[n] = true
+				return true
+			})
+		}
+		return false
+	})
+
+	return quoted
+}
+
+// 畳み込める被演算子。浮動小数点数は Inspect() とリテラルの表記が一致しないので畳み込まない
+func isLiteral(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean, *ast.StringLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+// 式を評価して、結果をリテラルにして返す。リテラルにできない結果の時は式をそのまま返す。
+// リテラルのトークンの位置は、元の式の先頭のトークン start の位置にする
+func fold(node ast.Expression, start token.Token) ast.Node {
+	result := evaluator.Eval(node, object.NewEnvironment())
+
+	t := token.Token{Line: start.Line, Column: start.Column}
+	switch result := result.(type) {
+	case *object.Integer:
+		t.Type, t.Literal = token.INT, fmt.Sprintf("%d", result.Value)
+		return &ast.IntegerLiteral{Token: t, Value: result.Value}
+
+	case *object.String:
+		t.Type, t.Literal = token.STRING, result.Value
+		return &ast.StringLiteral{Token: t, Value: result.Value}
+
+	case *object.Boolean:
+		if result.Value {
+			t.Type, t.Literal = token.TRUE, "true"
+		} else {
+			t.Type, t.Literal = token.FALSE, "false"
+		}
+		return &ast.Boolean{Token: t, Value: result.Value}
+
+	default:
+		return node
+	}
+}
+
+// 式の先頭のトークンを返す。畳み込んだ被演算子はリテラルなので、そのトークンが先頭になる
+func startToken(node ast.Expression) token.Token {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
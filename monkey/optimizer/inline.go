@@ -0,0 +1,246 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/builtins"
+)
+
+// 展開する関数の本体の式のノード数の上限
+const maxInlineSize = 20
+
+// トップレベルの let で束縛した小さな純粋な関数の呼び出しを、関数の本体の式で置き換える。
+// 展開する関数は次の条件をすべて満たすものに限る。
+//   - 束縛する名前が、プログラムの中でほかに let や仮引数や ++ と -- で束縛されていない
+//   - 束縛する名前が組み込み関数の名前でない。組み込み関数の名前は、束縛しても組み込み関数を指す
+//   - 本体が一つの式文だけで、その式が参照する識別子は仮引数だけ。
+//     式はリテラル、仮引数、前置演算子、中置演算子、添字演算子、配列リテラル、式文だけの枝の if 式からなる
+//
+// 呼び出しは、実引数がすべてリテラルか必ず束縛されている識別子で、その数が仮引数と同じで、その let 文より後ろの文にあるものだけを展開する。
+// 展開すると実引数は仮引数を使う場所で評価されるので、使わない枝や使わない関数では評価されなくなる。
+// 束縛されていない識別子の実引数は、評価されないと "identifier not found" のエラーにならなくなるので展開しない。
+// 仮引数を使わない関数も展開しない。quote の引数の中の呼び出しも展開しない。
+// 展開した呼び出しは ast.InlinedCall にして、エラーのスタックトレースに呼び出しが残るようにする
+func inlineFunctions(program *ast.Program) *ast.Program {
+	bindings := countBindings(program)
+	quoted := quotedNodes(program)
+	resolved := resolveBindings(program)
+
+	for i, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || bindings[let.Name.Value] != 1 || isBuiltin(let.Name.Value) {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+		body, ok := inlineableBody(fn)
+		if !ok {
+			continue
+		}
+
+		for _, rest := range program.Statements[i+1:] {
+			ast.Modify(rest, func(node ast.Node) ast.Node {
+				call, ok := node.(*ast.CallExpression)
+				if !ok || quoted[node] {
+					return node
+				}
+				ident, ok := call.Function.(*ast.Identifier)
+				if !ok || ident.Value != let.Name.Value {
+					return node
+				}
+				if inlined, ok := inlineCall(fn, body, call, resolved); ok {
+					return &ast.InlinedCall{Token: call.Token, Function: ident, Body: inlined}
+				}
+				return node
+			})
+		}
+	}
+
+	return program
+}
+
+// 名前が組み込み関数の名前かどうか。評価器は識別子を環境より先に組み込み関数から探すので、let で覆い隠せない
+func isBuiltin(name string) bool {
+	_, ok := builtins.Lookup(name)
+	return ok
+}
+
+// 名前ごとに、プログラムの中で束縛される回数を数える
+func countBindings(program *ast.Program) map[string]int {
+	bindings := map[string]int{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bindings[node.Name.Value]++
+		case *ast.FunctionLiteral:
+			for _, p := range node.Parameters {
+				bindings[p.Value]++
+			}
+		case *ast.PrefixExpression:
+			if ident, ok := node.Right.(*ast.Identifier); ok && (node.Operator == "++" || node.Operator == "--") {
+				bindings[ident.Value]++
+			}
+		case *ast.PostfixExpression:
+			if ident, ok := node.Left.(*ast.Identifier); ok {
+				bindings[ident.Value]++
+			}
+		}
+		return true
+	})
+
+	return bindings
+}
+
+// 関数が展開できる時は、その本体の式を返す
+func inlineableBody(fn *ast.FunctionLiteral) (ast.Expression, bool) {
+	if len(fn.Body.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+
+	// 仮引数を仮引数自身で置き換えて複製してみて、展開できる式かを確かめる
+	params := map[string]ast.Expression{}
+	for _, p := range fn.Parameters {
+		params[p.Value] = p
+	}
+	used := map[string]bool{}
+	size := 0
+	if _, ok := substitute(stmt.Expression, params, used, &size); !ok || size > maxInlineSize {
+		return nil, false
+	}
+	if len(used) != len(fn.Parameters) {
+		return nil, false
+	}
+
+	return stmt.Expression, true
+}
+
+// 呼び出しを、仮引数を実引数で置き換えた本体の複製にする。resolved は resolveBindings の結果
+func inlineCall(fn *ast.FunctionLiteral, body ast.Expression, call *ast.CallExpression, resolved map[*ast.Identifier]bool) (ast.Expression, bool) {
+	if len(call.Arguments) != len(fn.Parameters) {
+		return nil, false
+	}
+
+	args := map[string]ast.Expression{}
+	for i, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+			args[fn.Parameters[i].Value] = arg
+		case *ast.Identifier:
+			if !resolved[arg] {
+				return nil, false
+			}
+			args[fn.Parameters[i].Value] = arg
+		default:
+			return nil, false
+		}
+	}
+
+	size := 0
+	return substitute(body, args, map[string]bool{}, &size)
+}
+
+// 式を複製して、識別子を args の式で置き換える。args にない識別子と、展開できないノードがある時は false になる。
+// used には置き換えた識別子を、size には複製したノードの数を加える
+func substitute(node ast.Expression, args map[string]ast.Expression, used map[string]bool, size *int) (ast.Expression, bool) {
+	*size++
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return node, true // リテラルは書き換えられないので、共有してよい
+
+	case *ast.Identifier:
+		arg, ok := args[node.Value]
+		if !ok {
+			return nil, false
+		}
+		used[node.Value] = true
+		return arg, true
+
+	case *ast.PrefixExpression:
+		if node.Operator != "-" && node.Operator != "!" {
+			return nil, false
+		}
+		right, ok := substitute(node.Right, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		return &ast.PrefixExpression{Token: node.Token, Operator: node.Operator, Right: right}, true
+
+	case *ast.InfixExpression:
+		left, ok := substitute(node.Left, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		right, ok := substitute(node.Right, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		return &ast.InfixExpression{Token: node.Token, Left: left, Operator: node.Operator, Right: right}, true
+
+	case *ast.IndexExpression:
+		left, ok := substitute(node.Left, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		index, ok := substitute(node.Index, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		return &ast.IndexExpression{Token: node.Token, Left: left, Index: index}, true
+
+	case *ast.ArrayLiteral:
+		elements := []ast.Expression{}
+		for _, e := range node.Elements {
+			element, ok := substitute(e, args, used, size)
+			if !ok {
+				return nil, false
+			}
+			elements = append(elements, element)
+		}
+		return &ast.ArrayLiteral{Token: node.Token, Elements: elements}, true
+
+	case *ast.IfExpression:
+		condition, ok := substitute(node.Condition, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		consequence, ok := substituteBlock(node.Consequence, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		expr := &ast.IfExpression{Token: node.Token, Condition: condition, Consequence: consequence}
+		if node.Alternative != nil {
+			expr.Alternative, ok = substituteBlock(node.Alternative, args, used, size)
+			if !ok {
+				return nil, false
+			}
+		}
+		return expr, true
+
+	default:
+		return nil, false
+	}
+}
+
+// 式文だけのブロックを複製する
+func substituteBlock(block *ast.BlockStatement, args map[string]ast.Expression, used map[string]bool, size *int) (*ast.BlockStatement, bool) {
+	statements := []ast.Statement{}
+	for _, s := range block.Statements {
+		stmt, ok := s.(*ast.ExpressionStatement)
+		if !ok {
+			return nil, false
+		}
+		expr, ok := substitute(stmt.Expression, args, used, size)
+		if !ok {
+			return nil, false
+		}
+		statements = append(statements, &ast.ExpressionStatement{Token: stmt.Token, Expression: expr})
+	}
+	return &ast.BlockStatement{Token: block.Token, Statements: statements}, true
+}
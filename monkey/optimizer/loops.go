@@ -0,0 +1,426 @@
+package optimizer
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/builtins"
+	"monkey/token"
+)
+
+// 式の値の型。評価してもエラーにならないとわかっている式にだけ型をつける
+type valueType int
+
+const (
+	unknownType valueType = iota // 型がわからないか、エラーになるかもしれない
+	intType
+	boolType
+)
+
+// トップレベルの for 文から、ループの中で値が変わらない式を取り出して、ループの前の let 文で一度だけ評価する。
+// 取り出すのは、整数のリテラルと不変な整数の変数だけからなり、評価してもエラーにならない演算子の式に限る。
+// 不変な整数の変数とは、それより前のトップレベルの let 文で整数のリテラルを束縛し、ほかではどこでも束縛しない、組み込み関数でない名前である。
+// REPL の前の行で定義した関数は ++ や -- で変数を書き換えるかもしれないので、組み込み関数以外を呼び出すループからは取り出さない。
+// ループが一度も回らない時にも取り出した式を評価することになるが、エラーにならない式だけなので結果は変わらない。
+// 取り出した式を束縛する変数は、プログラムの環境に残らないように、ループと一緒に一度だけ回る for 文の中に入れる
+func hoistLoopInvariants(program *ast.Program) *ast.Program {
+	bindings := countBindings(program)
+	quoted := quotedNodes(program)
+
+	invariants := map[string]valueType{}
+	statements := []ast.Statement{}
+	hoistedCount := 0
+
+	for _, s := range program.Statements {
+		switch loop := s.(type) {
+		case *ast.LetStatement:
+			if _, ok := loop.Value.(*ast.IntegerLiteral); ok && bindings[loop.Name.Value] == 1 && !isBuiltin(loop.Name.Value) {
+				invariants[loop.Name.Value] = intType
+			}
+
+		case *ast.ForStatement:
+			if callsUserFunction(loop, bindings) {
+				break
+			}
+
+			h := &hoister{invariants: invariants, quoted: quoted, hoisted: map[string]ast.Expression{}, next: &hoistedCount}
+			if loop.Condition != nil {
+				loop.Condition, _ = ast.Modify(loop.Condition, h.modify).(ast.Expression)
+			}
+			if loop.Post != nil {
+				loop.Post, _ = ast.Modify(loop.Post, h.modify).(*ast.ExpressionStatement)
+			}
+			loop.Body, _ = ast.Modify(loop.Body, h.modify).(*ast.BlockStatement)
+
+			lets := []ast.Statement{}
+			for _, name := range h.order {
+				if expr, ok := h.hoisted[name]; ok {
+					lets = append(lets, hoistedLet(name, expr))
+				}
+			}
+			if len(lets) > 0 {
+				s = hoistedScope(lets, loop)
+			}
+		}
+
+		statements = append(statements, s)
+	}
+
+	program.Statements = statements
+	return program
+}
+
+// ループの中に、組み込み関数以外の関数の呼び出しがあるかどうか。プログラムの中で束縛し直した組み込み関数の名前も含める
+func callsUserFunction(loop *ast.ForStatement, bindings map[string]int) bool {
+	found := false
+	ast.Inspect(loop, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return !found
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok || bindings[ident.Value] > 0 {
+			found = true
+		} else if _, ok := builtins.Lookup(ident.Value); !ok && ident.Value != "quote" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// 取り出した変数の let 文とループを、一度だけ回る for 文の本体に入れる。
+// for 文の本体の let はその for 文の環境に束縛するので、取り出した変数は外からは見えない。
+// ループの中の return とエラーは、この for 文からもそのまま伝わる
+//
+//	for (let $licmScope = true; $licmScope; ) { let $licm0 = ...; <ループ> let $licmScope = false; }
+func hoistedScope(lets []ast.Statement, loop *ast.ForStatement) *ast.ForStatement {
+	const flag = "$licmScope"
+
+	body := append(lets, loop, hoistedLet(flag, ast.NewBool(false)))
+	return ast.NewFor(hoistedLet(flag, ast.NewBool(true)), ast.NewIdent(flag), nil, ast.NewBlock(body...))
+}
+
+// 一つの for 文から式を取り出す時の状態
+type hoister struct {
+	invariants map[string]valueType // 不変な変数と、取り出した式を束縛する変数の型
+	quoted     map[ast.Node]bool
+	hoisted    map[string]ast.Expression // 取り出した式を束縛する変数の名前と、その式
+	order      []string                  // hoisted の名前を取り出した順に並べたもの
+	next       *int                      // 次に取り出す式の番号。プログラム全体で名前が重ならないように共有する
+}
+
+// 木を子から順にたどるので、外側の式を取り出す時には、先に取り出した内側の式をその場に戻してまとめて取り出す
+func (h *hoister) modify(node ast.Node) ast.Node {
+	expr, ok := node.(ast.Expression)
+	if !ok || h.quoted[node] {
+		return node
+	}
+
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		ty := h.typeOf(expr)
+		if ty == unknownType {
+			return node
+		}
+		expr.Right = h.unhoist(expr.Right)
+		return h.hoist(expr, ty)
+
+	case *ast.InfixExpression:
+		ty := h.typeOf(expr)
+		if ty == unknownType {
+			return node
+		}
+		expr.Left = h.unhoist(expr.Left)
+		expr.Right = h.unhoist(expr.Right)
+		return h.hoist(expr, ty)
+	}
+
+	return node
+}
+
+// 式を取り出して、それを束縛する変数の識別子を返す。変数を含まない式は定数畳み込みに任せて、そのままにする
+func (h *hoister) hoist(expr ast.Expression, ty valueType) ast.Expression {
+	if !h.referencesVariable(expr) {
+		return expr
+	}
+
+	name := fmt.Sprintf("$licm%d", *h.next) // 字句解析器は '$' を識別子にしないので、プログラムの名前と重ならない
+	*h.next++
+
+	h.hoisted[name] = expr
+	h.order = append(h.order, name)
+	h.invariants[name] = ty
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+// 取り出した式を束縛する変数の識別子なら、取り出すのをやめて元の式を返す
+func (h *hoister) unhoist(expr ast.Expression) ast.Expression {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok {
+		return expr
+	}
+	original, ok := h.hoisted[ident.Value]
+	if !ok {
+		return expr
+	}
+
+	delete(h.hoisted, ident.Value)
+	return original
+}
+
+func (h *hoister) referencesVariable(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.PrefixExpression:
+		return h.referencesVariable(expr.Right)
+	case *ast.InfixExpression:
+		return h.referencesVariable(expr.Left) || h.referencesVariable(expr.Right)
+	default:
+		return false
+	}
+}
+
+// ループの中で値が変わらず、評価してもエラーにならない式の型を返す。そうでない式は unknownType になる
+func (h *hoister) typeOf(expr ast.Expression) valueType {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return intType
+	case *ast.Boolean:
+		return boolType
+	case *ast.Identifier:
+		return h.invariants[expr.Value]
+	case *ast.PrefixExpression:
+		return prefixType(expr.Operator, h.typeOf(expr.Right))
+	case *ast.InfixExpression:
+		return infixType(expr, h.typeOf(expr.Left), h.typeOf(expr.Right))
+	default:
+		return unknownType
+	}
+}
+
+func prefixType(operator string, right valueType) valueType {
+	switch {
+	case right == unknownType:
+		return unknownType
+	case operator == "-" && right == intType:
+		return intType
+	case operator == "!":
+		return boolType
+	default:
+		return unknownType
+	}
+}
+
+func infixType(expr *ast.InfixExpression, left, right valueType) valueType {
+	if left == unknownType || right == unknownType {
+		return unknownType
+	}
+
+	switch expr.Operator {
+	case "==", "!=", "&&", "||":
+		return boolType
+	}
+
+	if left != intType || right != intType {
+		return unknownType
+	}
+
+	switch expr.Operator {
+	case "+", "-", "*":
+		return intType
+	case "<", ">", "<=", ">=":
+		return boolType
+	case "/", "%":
+		// 右辺が 0 でないリテラルの時だけ、0 での割り算のエラーにならない
+		if lit, ok := expr.Right.(*ast.IntegerLiteral); ok && lit.Value != 0 {
+			return intType
+		}
+	case "**":
+		// 指数が負の時は結果が浮動小数点数になる
+		if lit, ok := expr.Right.(*ast.IntegerLiteral); ok && lit.Value >= 0 {
+			return intType
+		}
+	}
+	return unknownType
+}
+
+func hoistedLet(name string, value ast.Expression) *ast.LetStatement {
+	return &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let"},
+		Name:  &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name},
+		Value: value,
+	}
+}
+
+// 整数の変数 x について、x * 2 と 2 * x を x + x に、x ** 2 を x * x に置き換える。
+// 置き換えるのは、このプログラムの中でそれより前に整数を束縛したとわかっている名前だけである。
+// REPL の前の行や prelude で束縛した名前は値がわからないので、このプログラムで束縛し直すまでは置き換えない。
+// 関数の本体は、後の行で外側の変数を束縛し直してから呼び出されるかもしれないので、その中も置き換えない
+func reduceStrength(program *ast.Program) *ast.Program {
+	candidates := intVariables(program)
+	skip := quotedNodes(program)
+	for node := range functionBodies(program) {
+		skip[node] = true
+	}
+
+	ints := map[string]bool{}
+	reduce := func(node ast.Node) ast.Node {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || skip[node] {
+			return node
+		}
+		return reduceInfix(infix, ints)
+	}
+
+	for i, s := range program.Statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			s.Value, _ = ast.Modify(s.Value, reduce).(ast.Expression)
+			// 値を評価してから束縛するので、値の中ではまだ前の束縛を指す
+			if candidates[s.Name.Value] && isProvenInt(s.Name.Value, s.Value, ints) {
+				ints[s.Name.Value] = true
+			}
+			continue
+
+		case *ast.ForStatement:
+			// for 文の初期化で整数のリテラルを束縛したループ変数は、その for 文の中では整数とわかっている
+			if s.Init != nil && candidates[s.Init.Name.Value] && !ints[s.Init.Name.Value] {
+				if _, ok := s.Init.Value.(*ast.IntegerLiteral); ok {
+					ints[s.Init.Name.Value] = true
+					program.Statements[i] = ast.Modify(s, reduce).(ast.Statement)
+					delete(ints, s.Init.Name.Value)
+					continue
+				}
+			}
+		}
+
+		program.Statements[i] = ast.Modify(s, reduce).(ast.Statement)
+	}
+
+	return program
+}
+
+// 整数の変数 ident を使う infix を置き換える。置き換えられない時はそのまま返す
+func reduceInfix(infix *ast.InfixExpression, ints map[string]bool) ast.Expression {
+	isIntVariable := func(expr ast.Expression) (*ast.Identifier, bool) {
+		ident, ok := expr.(*ast.Identifier)
+		return ident, ok && ints[ident.Value]
+	}
+	isLiteral := func(expr ast.Expression, value int64) bool {
+		lit, ok := expr.(*ast.IntegerLiteral)
+		return ok && lit.Value == value
+	}
+
+	switch infix.Operator {
+	case "*":
+		if ident, ok := isIntVariable(infix.Left); ok && isLiteral(infix.Right, 2) {
+			return reducedInfix(infix, ident, "+")
+		}
+		if ident, ok := isIntVariable(infix.Right); ok && isLiteral(infix.Left, 2) {
+			return reducedInfix(infix, ident, "+")
+		}
+	case "**":
+		if ident, ok := isIntVariable(infix.Left); ok && isLiteral(infix.Right, 2) {
+			return reducedInfix(infix, ident, "*")
+		}
+	}
+	return infix
+}
+
+// 関数リテラルの中のノードの集合を返す
+func functionBodies(program *ast.Program) map[ast.Node]bool {
+	inside := map[ast.Node]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); !ok {
+			return true
+		}
+		ast.Inspect(node, func(n ast.Node) bool {
+			inside[n] = true
+			return true
+		})
+		return false
+	})
+
+	return inside
+}
+
+// ident operator ident の式を作る
+func reducedInfix(orig *ast.InfixExpression, ident *ast.Identifier, operator string) *ast.InfixExpression {
+	t := orig.Token
+	t.Literal = operator
+	if operator == "+" {
+		t.Type = token.PLUS
+	} else {
+		t.Type = token.ASTERISK
+	}
+	return &ast.InfixExpression{Token: t, Left: ident, Operator: operator, Right: ident}
+}
+
+// プログラムの中で整数だけを束縛する名前の集合を返す。
+// 整数だけを束縛するとは、let で整数のリテラルか、自身と整数のリテラルの +, -, * の式だけを束縛し、
+// ほかには ++ と -- でしか束縛しないことである。組み込み関数と同じ名前は、束縛しても組み込み関数を指すので除く
+func intVariables(program *ast.Program) map[string]bool {
+	ints := map[string]bool{}
+	notInt := map[string]bool{}
+
+	for _, name := range builtins.Names() {
+		notInt[name] = true
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if isIntUpdate(node.Name.Value, node.Value) {
+				ints[node.Name.Value] = true
+			} else {
+				notInt[node.Name.Value] = true
+			}
+		case *ast.FunctionLiteral:
+			for _, p := range node.Parameters {
+				notInt[p.Value] = true
+			}
+		}
+		return true
+	})
+
+	for name := range notInt {
+		delete(ints, name)
+	}
+	return ints
+}
+
+// let name = value; で name に整数を束縛するとわかるかどうか。
+// value が整数のリテラルの時か、name がすでに整数とわかっていて value が name と整数のリテラルの +, -, * の式の時
+func isProvenInt(name string, value ast.Expression, ints map[string]bool) bool {
+	if _, ok := value.(*ast.IntegerLiteral); ok {
+		return true
+	}
+	return ints[name] && isIntUpdate(name, value)
+}
+
+// let name = value; の value が、整数のリテラルか、name と整数のリテラルの +, -, * の式かどうか
+func isIntUpdate(name string, value ast.Expression) bool {
+	operand := func(expr ast.Expression) bool {
+		switch expr := expr.(type) {
+		case *ast.IntegerLiteral:
+			return true
+		case *ast.Identifier:
+			return expr.Value == name
+		default:
+			return false
+		}
+	}
+
+	switch value := value.(type) {
+	case *ast.IntegerLiteral:
+		return true
+	case *ast.InfixExpression:
+		switch value.Operator {
+		case "+", "-", "*":
+			return operand(value.Left) && operand(value.Right)
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package optimizer
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+)
+
+// 最適化の強さ。コマンドラインの -O0, -O1, -O2 に対応する
+type Level int
+
+const (
+	O0 Level = iota // 最適化しない
+	O1              // 定数畳み込みだけをする
+	O2              // 定数畳み込みに加えて、小さな関数の展開、演算の置き換え、ループの不変式の取り出し、実行されないコードの除去をする
+)
+
+// 構文解析した木を書き換える最適化の一段。
+// Run は受け取った木をその場で書き換えてもよく、書き換えた木を返す。どの段も評価した結果を変えてはいけない
+type Pass struct {
+	Name string // -dump-passes で出力する時の名前
+	Run  func(*ast.Program) *ast.Program
+}
+
+// 最適化の段の並び。段を追加する時は、ここの並びに追加すればよい
+var pipeline = []struct {
+	level Level // この強さ以上の時に実行する
+	pass  Pass
+}{
+	{O2, Pass{Name: "inlining", Run: inlineFunctions}}, // 展開した式も畳み込めるように、定数畳み込みより先に実行する
+	{O1, Pass{Name: "constant-folding", Run: foldConstants}},
+	{O2, Pass{Name: "strength-reduction", Run: reduceStrength}},
+	{O2, Pass{Name: "loop-invariant-code-motion", Run: hoistLoopInvariants}},
+	{O2, Pass{Name: "dead-code-elimination", Run: eliminateDeadCode}},
+}
+
+// level で実行する最適化の段を、実行する順に返す
+func Passes(level Level) []Pass {
+	passes := []Pass{}
+	for _, p := range pipeline {
+		if level >= p.level {
+			passes = append(passes, p.pass)
+		}
+	}
+	return passes
+}
+
+// 最適化の段を順に実行する
+type Optimizer struct {
+	passes []Pass
+	dump   io.Writer // nil でない時は、段を実行するたびにその後の木を書き出す
+}
+
+func New(level Level) *Optimizer {
+	return &Optimizer{passes: Passes(level)}
+}
+
+// 段を実行するたびに、その後の木を w に書き出すようにする。段ごとの変換を確かめる時に使う
+func (o *Optimizer) SetDump(w io.Writer) {
+	o.dump = w
+}
+
+// マクロを展開した後の木を受け取って、最適化した木を返す
+func (o *Optimizer) Optimize(program *ast.Program) *ast.Program {
+	for _, p := range o.passes {
+		program = p.Run(program)
+		if o.dump != nil {
+			fmt.Fprintf(o.dump, "=== after %s ===\n%s\n", p.Name, program.String())
+		}
+	}
+	return program
+}
@@ -0,0 +1,359 @@
+package optimizer
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		level    Level
+		expected []string
+	}{
+		{O0, []string{}},
+		{O1, []string{"constant-folding"}},
+		{O2, []string{"inlining", "constant-folding", "strength-reduction", "loop-invariant-code-motion", "dead-code-elimination"}},
+	}
+
+	for _, tt := range tests {
+		passes := Passes(tt.level)
+		if len(passes) != len(tt.expected) {
+			t.Errorf("wrong number of passes for O%d. want=%d, got=%d",
+				tt.level, len(tt.expected), len(passes))
+			continue
+		}
+		for i, name := range tt.expected {
+			if passes[i].Name != name {
+				t.Errorf("wrong pass %d for O%d. want=%q, got=%q",
+					i, tt.level, name, passes[i].Name)
+			}
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"-5 + 10", "5"},
+		{"2 ** 10 % 7", "2"},
+		{"1 < 2 == true", "true"},
+		{"!true || false", "false"},
+		{`"foo" + "bar"`, "foobar"},
+		{"let x = 60 * 60; x", "let x = 3600;x"},
+		{"fn(x) { x * (2 + 3) }", "fn(x) (x * 5)"},
+		// 識別子を含む式は畳み込まない
+		{"x + 1 + 2", "((x + 1) + 2)"},
+		// エラーになる式と、結果が浮動小数点数になる式はそのまま残す
+		{"1 / 0", "(1 / 0)"},
+		{"2 ** -1", "(2 ** -1)"},
+		{"1 + true", "(1 + true)"},
+		// quote の引数は木そのものが値なので書き換えない
+		{"quote(1 + 2)", "quote((1 + 2))"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := New(O1).Optimize(program)
+
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestDeadCodeElimination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { return 1; 2; 3 }", "fn() return 1;"},
+		{"fn() { 1; 2; 3 }", "fn() 3"},
+		{"1; 2; 3", "3"},
+		{"1; 2; let x = 3;", "let x = 3;"},
+		{"if (true) { 1 } else { 2 }", "iftrue 1"},
+		{"if (1 < 2) { 1 } else { 2 }", "iftrue 1"},
+		// 副作用があるかもしれない式文は残す
+		{"puts(1); 2", "puts(1)2"},
+		{"if (x) { 1 } else { 2 }", "ifx 1else 2"},
+		// quote の引数の中は書き換えない
+		{"quote(fn() { 1; if (true) { 2 } else { 3 } }); 4", "quote(fn() 1iftrue 2else 3)4"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := New(O2).Optimize(program)
+
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestInlining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let double = fn(x) { x * 2 }; let y = 3; double(y)", "let double = fn(x) (x * 2);let y = 3;(y * 2)"},
+		{"let add = fn(a, b) { a + b }; let f = fn(y) { add(y, 1) };", "let add = fn(a, b) (a + b);let f = fn(y) (y + 1);"},
+		{"let abs = fn(x) { if (x < 0) { -x } else { x } }; let f = fn(n) { abs(n) }", "let abs = fn(x) if(x < 0) (-x)else x;let f = fn(n) if(n < 0) (-n)else n;"},
+		// 実引数がリテラルか識別子でない時と、数が合わない時は展開しない
+		{"let double = fn(x) { x * 2 }; double(f())", "let double = fn(x) (x * 2);double(f())"},
+		{"let double = fn(x) { x * 2 }; double(1, 2)", "let double = fn(x) (x * 2);double(1, 2)"},
+		// 仮引数以外の識別子を参照する関数と、本体が一つの式でない関数は展開しない
+		{"let g = fn(x) { x + y }; g(1)", "let g = fn(x) (x + y);g(1)"},
+		{"let g = fn(x) { len(x) }; g(a)", "let g = fn(x) len(x);g(a)"},
+		{"let g = fn(x) { let y = x; y }; g(1)", "let g = fn(x) let y = x;y;g(1)"},
+		{"let g = fn(x) { 1 }; g(a)", "let g = fn(x) 1;g(a)"},
+		// 束縛し直される名前と、let より前の呼び出しは展開しない
+		{"let g = fn(x) { x }; let g = fn(x) { 0 }; g(1)", "let g = fn(x) x;let g = fn(x) 0;g(1)"},
+		{"let h = fn(g) { g(1) }; let g = fn(x) { x }; h(g)", "let h = fn(g) g(1);let g = fn(x) x;h(g)"},
+		{"let g = fn(x) { x }; quote(g(1))", "let g = fn(x) x;quote(g(1))"},
+		{"let len = fn(x) { x + 1 }; len(1)", "let len = fn(x) (x + 1);len(1)"},
+		// 必ず束縛されているとわからない識別子を実引数にした呼び出しは展開しない。展開すると評価されないことがある
+		{"let g = fn(x) { x * 2 }; g(y)", "let g = fn(x) (x * 2);g(y)"},
+		{"let g = fn(x) { x * 2 }; g(y); let y = 1;", "let g = fn(x) (x * 2);g(y)let y = 1;"},
+		{"let g = fn(x) { x * 2 }; if (true) { let y = 1 }; g(y)", "let g = fn(x) (x * 2);iftrue let y = 1;g(y)"},
+		{"let g = fn(x) { x * 2 }; for (let y = 1; ; ) { g(y) } g(y)", "let g = fn(x) (x * 2);for (let y = 1; ; ) (y * 2)g(y)"},
+		{"let g = fn(x) { x * 2 }; let f = fn() { g(y) }; let y = 1;", "let g = fn(x) (x * 2);let f = fn() g(y);let y = 1;"},
+		{"let g = fn(x) { x * 2 }; let f = fn() { g(f) };", "let g = fn(x) (x * 2);let f = fn() (f * 2);"},
+		{"let g = fn(x) { x * 2 }; g(len)", "let g = fn(x) (x * 2);(len * 2)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := inlineFunctions(program)
+
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestInliningMatchesHandInlined(t *testing.T) {
+	// 補助関数を使った fibonacci を展開すると、手で展開したものと同じ木になる
+	helper := `
+let minus = fn(a, b) { a - b };
+let fib = fn(x) { if (x < 2) { x } else { fib(minus(x, 1)) + fib(minus(x, 2)) } };
+fib(15)`
+	handInlined := `
+let minus = fn(a, b) { a - b };
+let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } };
+fib(15)`
+
+	got := New(O2).Optimize(parse(t, helper)).String()
+	want := New(O2).Optimize(parse(t, handInlined)).String()
+	if got != want {
+		t.Errorf("inlined program differs from the hand-inlined one.\nwant=%q\ngot =%q", want, got)
+	}
+
+	if run(t, helper, O2) != "610" {
+		t.Errorf("wrong result. want=%q, got=%q", "610", run(t, helper, O2))
+	}
+}
+
+func TestLoopInvariantCodeMotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let n = 10; let k = 3; for (let i = 0; i < n * k; i++) { puts(i + n * k) }",
+			"let n = 10;let k = 3;for (let $licmScope = true; $licmScope; ) let $licm0 = (n * k);let $licm1 = (n * k);" +
+				"for (let i = 0; (i < $licm0); (i++)) puts((i + $licm1))let $licmScope = false;",
+		},
+		{
+			// 内側の式を先に取り出した後でも、外側の式ごとまとめて取り出す
+			"let n = 10; for (;;) { -(n + 1) * 2 > 5 }",
+			"let n = 10;for (let $licmScope = true; $licmScope; ) let $licm3 = (((-(n + 1)) * 2) > 5);for (; ; ) $licm3let $licmScope = false;",
+		},
+		// 束縛し直される変数や、整数のリテラルでない値の変数を使う式は取り出さない
+		{"let n = 10; for (;;) { let n = 5; n * 2 }", "let n = 10;for (; ; ) let n = 5;(n * 2)"},
+		{`let s = "a"; for (;;) { s + s }`, `let s = a;for (; ; ) (s + s)`},
+		{"let n = 10; for (let i = 0; true; i++) { n * i }", "let n = 10;for (let i = 0; true; (i++)) (n * i)"},
+		// エラーになるかもしれない式と、let より前の for 文は取り出さない
+		{"let n = 10; for (;;) { n / 0; n % n; n ** -1 }", "let n = 10;for (; ; ) (n / 0)(n % n)(n ** (-1))"},
+		{"for (;;) { n * 2 } let n = 10;", "for (; ; ) (n * 2)let n = 10;"},
+		{"let n = 10; for (;;) { quote(n * 2) }", "let n = 10;for (; ; ) quote((n * 2))"},
+		// 前の行で定義した関数が変数を書き換えるかもしれないので、組み込み関数以外を呼び出すループからは取り出さない
+		{"let n = 10; for (;;) { f(); n * 2 }", "let n = 10;for (; ; ) f()(n * 2)"},
+		// 組み込み関数の名前は let で束縛しても組み込み関数を指すので、その名前を使う式も取り出さない
+		{"let len = 10; for (;;) { len * 2 }", "let len = 10;for (; ; ) (len * 2)"},
+		{"let n = 10; let len = fn(x) { x }; for (;;) { len(n * 2) }", "let n = 10;let len = fn(x) x;for (; ; ) len((n * 2))"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := hoistLoopInvariants(program)
+
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestStrengthReduction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5; x * 2", "let x = 5;(x + x)"},
+		{"let x = 5; 2 * x", "let x = 5;(x + x)"},
+		{"let x = 5; x ** 2", "let x = 5;(x * x)"},
+		{"for (let i = 0; i < 10; i++) { let i = i + 1; puts(i * 2) }", "for (let i = 0; (i < 10); (i++)) let i = (i + 1);puts((i + i))"},
+		// 整数でないかもしれない変数はそのままにする
+		{`let x = "a"; x * 2`, `let x = a;(x * 2)`},
+		{"let f = fn(x) { x * 2 }", "let f = fn(x) (x * 2);"},
+		{"let x = 5; let x = x / 2; x * 2", "let x = 5;let x = (x / 2);(x * 2)"},
+		{"let len = 5; len * 2", "let len = 5;(len * 2)"},
+		{"let x = 5; x * 3; x ** 3", "let x = 5;(x * 3)(x ** 3)"},
+		// このプログラムで整数を束縛する前の名前は、REPL の前の行や prelude で何を束縛したかわからない
+		{"x * 2", "(x * 2)"},
+		{"x * 2; let x = 5; x * 2", "(x * 2)let x = 5;(x + x)"},
+		{"let x = x + 1; x * 2", "let x = (x + 1);(x * 2)"},
+		{"let x = 5; let x = x + 1; x * 2", "let x = 5;let x = (x + 1);(x + x)"},
+		{"if (c) { let x = 5 } x * 2", "ifc let x = 5;(x * 2)"},
+		{"for (let i = 0; i < 3; i++) {} i * 2", "for (let i = 0; (i < 3); (i++)) (i * 2)"},
+		// 関数は、外側の変数を束縛し直した後で呼び出されるかもしれない
+		{"let x = 5; let f = fn() { x * 2 }", "let x = 5;let f = fn() (x * 2);"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := reduceStrength(program)
+
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestOptimizeAcrossREPLLines(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		expected string
+	}{
+		// 前の行で束縛した文字列の変数を、整数と思い込んで置き換えない。結果は puts の出力と最後の値
+		{[]string{`let x = "a";`, "x * 2"}, "ERROR: type mismatch: STRING * INTEGER"},
+		{[]string{"let x = 5; let f = fn() { x * 2 };", `let x = "a";`, "f()"}, "ERROR: type mismatch: STRING * INTEGER"},
+		// 前の行で定義した関数が書き換える変数を含む式は、ループから取り出さない
+		{[]string{"let inc = fn() { n++ };", "let n = 1; for (let i = 0; i < 2; i++) { inc(); puts(n * 3) }"}, "6\n9\nnull"},
+		// 取り出した式を束縛する変数は、プログラムの環境に残らない
+		{[]string{"let n = 2; for (let i = 0; i < 2; i++) { puts(i + n * n) }"}, "4\n5\nnull"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := evaluator.NewEnvironment()
+		env.SetOutput(&out)
+		var result object.Object
+		for _, line := range tt.lines {
+			program := parse(t, line)
+			result = evaluator.Eval(New(O2).Optimize(program), env)
+		}
+
+		got := out.String() + result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = out.String() + "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.lines, tt.expected, got)
+		}
+		for _, name := range []string{"$licm0", "$licmScope"} {
+			if _, ok := env.Get(name); ok {
+				t.Errorf("%s is bound in the environment after %q", name, tt.lines)
+			}
+		}
+	}
+}
+
+func TestOptimizePreservesResults(t *testing.T) {
+	tests := []string{
+		"let f = fn(x) { if (x > 2 * 3) { return x - 1 + 1; 99 } x * (4 - 2) }; f(3) + f(10)",
+		"let a = [1 + 1, 2 * 2]; a[3 - 2]",
+		`let greet = fn(name) { "hello " + name }; greet("wor" + "ld")`,
+		"let x = 1 / 0; x",
+		"let m = macro(a) { quote(unquote(a) + 1 + 2) }; m(3 * 4)",
+		"if (2 > 1) { 10 } else { 20 }",
+		"fn() { 1; 2; return 3; 4 }()",
+		"let sq = fn(x) { x * x }; let y = 3; sq(y) + sq(4)",
+		"let pick = fn(c, a, b) { if (c) { a } else { b } }; [pick(true, 1, 2), pick(false, 1, 2)]",
+		"let n = 4; let f = fn() { for (let i = 0; i < n * n; i++) { if (i == n + 3) { return i * 2 } } }; f()",
+		"let n = 4; for (let i = 0; i < n - n; i++) { n / 0 }",
+		"let x = 9223372036854775807; [x * 2, x ** 2]",
+		// 展開した呼び出しも、展開しなかった時と同じエラーとスタックトレースになる
+		"let pick = fn(c, x) { if (c) { x } else { 0 } }; pick(false, undefinedName)",
+		`let double = fn(x) { x * 2 }; double("a")`,
+		"let double = fn(x) { x * 2 }; let f = fn(s) {\n double(s) }; f(true)",
+		// 組み込み関数の名前は let で覆い隠せないので、その名前の関数は展開しない
+		"let len = fn(x) { x + 1 }; len(1);",
+		"quote(fn() { 1; if (true) { 2 } else { 3 } });",
+	}
+
+	for _, input := range tests {
+		want := run(t, input, O0)
+		got := run(t, input, O2)
+		if got != want {
+			t.Errorf("optimization changed the result of %q. want=%q, got=%q",
+				input, want, got)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	var out bytes.Buffer
+
+	opt := New(O2)
+	opt.SetDump(&out)
+	opt.Optimize(parse(t, "1; 2 + 3"))
+
+	expected := "=== after inlining ===\n1(2 + 3)\n" +
+		"=== after constant-folding ===\n15\n" +
+		"=== after strength-reduction ===\n15\n" +
+		"=== after loop-invariant-code-motion ===\n15\n" +
+		"=== after dead-code-elimination ===\n5\n"
+	if out.String() != expected {
+		t.Errorf("wrong dump. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// REPL と同じくマクロを展開してから最適化して評価し、結果を Inspect() した文字列を返す
+func run(t *testing.T, input string, level Level) string {
+	t.Helper()
+
+	program := parse(t, input)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		t.Fatalf("macro expansion failed: %s", err.Inspect())
+	}
+
+	optimized := New(level).Optimize(expanded.(*ast.Program))
+	return evaluator.Eval(optimized, object.NewEnvironment()).Inspect()
+}
@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/builtins"
+)
+
+// 識別子の参照ごとに、評価する時に必ず束縛されているかどうかを調べる。束縛されている参照だけが結果に入る。
+// 束縛されているとみなすのは、組み込み関数の名前と、その参照より前に必ず評価される let 文と仮引数で束縛した名前である。
+//   - let 文は、同じブロックのそれより後ろの文から見える。関数リテラルを束縛する let 文の名前は、その関数の本体からも見える
+//   - if 式の枝と for 文の本体の let 文は、評価されないことがあるので、その外からは見えないものとして扱う
+//   - for 文の初期化の let 文は、その for 文の中から見える
+//   - 関数の本体からは、仮引数と、関数リテラルを評価した時に束縛されていた名前が見える
+//
+// REPL の前の行で束縛した名前は、このプログラムからはわからないので束縛されていないものとして扱う
+func resolveBindings(program *ast.Program) map[*ast.Identifier]bool {
+	r := &resolver{bound: map[*ast.Identifier]bool{}}
+	scope := map[string]bool{}
+	for _, name := range builtins.Names() {
+		scope[name] = true
+	}
+	r.statements(program.Statements, scope)
+	return r.bound
+}
+
+type resolver struct {
+	bound map[*ast.Identifier]bool
+}
+
+// scope はその時点で必ず束縛されている名前の集合。let 文で書き足していく
+func (r *resolver) statements(statements []ast.Statement, scope map[string]bool) {
+	for _, s := range statements {
+		r.statement(s, scope)
+	}
+}
+
+func (r *resolver) statement(s ast.Statement, scope map[string]bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok {
+			// 本体が評価されるのは呼び出した時なので、その時には名前が束縛されている
+			inner := copyScope(scope)
+			inner[s.Name.Value] = true
+			r.function(fn, inner)
+		} else {
+			r.expression(s.Value, scope)
+		}
+		scope[s.Name.Value] = true
+
+	case *ast.ReturnStatement:
+		r.expression(s.ReturnValue, scope)
+
+	case *ast.ExpressionStatement:
+		r.expression(s.Expression, scope)
+
+	case *ast.ForStatement:
+		inner := copyScope(scope)
+		if s.Init != nil {
+			r.statement(s.Init, inner)
+		}
+		r.expression(s.Condition, inner)
+		r.block(s.Body, inner)
+		if s.Post != nil {
+			r.statement(s.Post, inner)
+		}
+	}
+}
+
+// ブロックの let 文は、ブロックの外からは見えないものとして扱う
+func (r *resolver) block(block *ast.BlockStatement, scope map[string]bool) {
+	if block != nil {
+		r.statements(block.Statements, copyScope(scope))
+	}
+}
+
+func (r *resolver) function(fn *ast.FunctionLiteral, scope map[string]bool) {
+	inner := copyScope(scope)
+	for _, p := range fn.Parameters {
+		inner[p.Value] = true
+	}
+	r.statements(fn.Body.Statements, inner)
+}
+
+func (r *resolver) expression(node ast.Expression, scope map[string]bool) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if scope[node.Value] {
+			r.bound[node] = true
+		}
+
+	case *ast.PrefixExpression:
+		r.expression(node.Right, scope)
+
+	case *ast.PostfixExpression:
+		r.expression(node.Left, scope)
+
+	case *ast.InfixExpression:
+		r.expression(node.Left, scope)
+		r.expression(node.Right, scope)
+
+	case *ast.IndexExpression:
+		r.expression(node.Left, scope)
+		r.expression(node.Index, scope)
+
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			r.expression(e, scope)
+		}
+
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			r.expression(key, scope)
+			r.expression(value, scope)
+		}
+
+	case *ast.CallExpression:
+		r.expression(node.Function, scope)
+		for _, arg := range node.Arguments {
+			r.expression(arg, scope)
+		}
+
+	case *ast.IfExpression:
+		r.expression(node.Condition, scope)
+		r.block(node.Consequence, scope)
+		r.block(node.Alternative, scope)
+
+	case *ast.FunctionLiteral:
+		r.function(node, scope)
+
+	case *ast.InlinedCall:
+		r.expression(node.Body, scope)
+	}
+}
+
+func copyScope(scope map[string]bool) map[string]bool {
+	copied := make(map[string]bool, len(scope))
+	for name := range scope {
+		copied[name] = true
+	}
+	return copied
+}
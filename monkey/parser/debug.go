@@ -0,0 +1,7 @@
+//go:build debug
+
+package parser
+
+func init() {
+	validateAfterParse = true
+}
@@ -0,0 +1,32 @@
+package parser
+
+import "monkey/token"
+
+type ErrorCode string
+
+const (
+	LEXICAL_ERROR      = "LEXICAL_ERROR"      // 字句解析で見つかったエラー
+	UNEXPECTED_TOKEN   = "UNEXPECTED_TOKEN"   // 次のトークンが期待したタイプではなかった
+	NO_PREFIX_PARSE_FN = "NO_PREFIX_PARSE_FN" // 式の先頭に来られないトークンだった
+	INVALID_INTEGER    = "INVALID_INTEGER"    // 整数リテラルを int64 にできなかった
+	INVALID_FLOAT      = "INVALID_FLOAT"      // 浮動小数点数リテラルを float64 にできなかった
+	UNTERMINATED_BLOCK = "UNTERMINATED_BLOCK" // '}' で閉じられないまま EOF に達した
+	INVALID_OPERAND    = "INVALID_OPERAND"    // ++ や -- を識別子以外に使った
+	UNEXPECTED_STMT    = "UNEXPECTED_STMT"    // 式だけを受けつける所に文があった
+	UNKNOWN_LITERAL    = "UNKNOWN_LITERAL"    // 10kb のようなリテラルを解釈する関数が登録されていなかった
+	INVALID_LITERAL    = "INVALID_LITERAL"    // 登録した関数がリテラルを解釈できなかった
+)
+
+// 構文解析のエラー。エディタなどのツールがエラーの箇所を示せるように、位置とトークンのタイプを構造化して持つ
+type ParseError struct {
+	Pos      token.Position
+	Code     ErrorCode
+	Expected token.TokenType // 期待していたトークンのタイプ。UNEXPECTED_TOKEN の時だけセットされる
+	Got      token.TokenType // エラーの原因になったトークンのタイプ
+	Message  string
+}
+
+// "行:列: メッセージ" の形の文字列を返す
+func (e *ParseError) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"monkey/ast"
+	"strings"
+)
+
+// token.CUSTOM のリテラルを解釈する関数。literal はリテラル全体の文字列(たとえば "10kb")で、
+// リテラルの代わりに木に入れる式を返す。ast.NewInt などで組み立てた式を返せばよい。
+// 解釈できない時に返したエラーは、そのリテラルの位置の構文解析エラーになる
+type LiteralHandler func(literal string) (ast.Expression, error)
+
+// 10kb や 5s のように数値の直後に文字が続くリテラルを解釈する関数を、その文字(suffix、たとえば "kb")ごとに登録する。
+// #ff00ff のように '#' で始まるリテラルは、suffix に "#" を渡して登録する。
+// 文法を変えずに、言語を組み込む側が領域ごとのリテラルを追加するために使う
+func (p *Parser) RegisterLiteral(suffix string, handler LiteralHandler) {
+	p.literalHandlers[suffix] = handler
+}
+
+// 登録した関数でリテラルを解釈する。登録していない種類のリテラルはエラーになる
+func (p *Parser) parseCustomLiteral() ast.Expression {
+	tok := p.curToken
+	suffix := literalSuffix(tok.Literal)
+
+	handler, ok := p.literalHandlers[suffix]
+	if !ok {
+		p.addError(tok, UNKNOWN_LITERAL, "no literal handler registered for %q in %s", suffix, tok.Literal)
+		return p.badExpression(tok)
+	}
+
+	exp, err := handler(tok.Literal)
+	if err != nil {
+		p.addError(tok, INVALID_LITERAL, "could not parse %s: %s", tok.Literal, err)
+		return p.badExpression(tok)
+	}
+	if exp == nil {
+		p.addError(tok, INVALID_LITERAL, "literal handler for %q returned no expression for %s", suffix, tok.Literal)
+		return p.badExpression(tok)
+	}
+	return exp
+}
+
+// "#ff00ff" なら "#"、"10kb" や "1.5kb" なら数値の後の "kb"
+func literalSuffix(literal string) string {
+	if strings.HasPrefix(literal, "#") {
+		return "#"
+	}
+	return strings.TrimLeft(literal, "0123456789._")
+}
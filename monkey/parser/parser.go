@@ -6,74 +6,65 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
-// 演算子の優先順位を決める部分
-const (
-	_ int = iota
-	LOWEST
-	EQUALS      // ==
-	LESSGREATER // > or <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      //  -X or !X
-	CALL        // myfunction(X)
-)
-
-// トークンのタイプとその優先順位を関連づけるテーブル
-var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-}
+// debug タグをつけてビルドした時とテストの時には、エラーなしで構文解析できた木を ast.Validate で確かめる。
+// 違反が見つかった時は構文解析器のバグなので panic する
+var validateAfterParse = false
 
 type Parser struct {
-	l         *lexer.Lexer // Lexer インスタンスへのポインタ、このインスタンスの NextToken() を呼び出し、入力から次のトークンを繰り返し取得する
-	curToken  token.Token  // Parser が現在読んでいるトークン, Parser はこのトークンを見て次に何をするか判断する
-	peekToken token.Token  // Parser が次に読むトークン
-	errors    []string     // Parser が文字列で表現されたエラーの情報を保持するための配列
+	l         *lexer.Lexer  // Lexer インスタンスへのポインタ、このインスタンスの NextToken() を呼び出し、入力から次のトークンを繰り返し取得する
+	curToken  token.Token   // Parser が現在読んでいるトークン, Parser はこのトークンを見て次に何をするか判断する
+	peekToken token.Token   // Parser が次に読むトークン
+	errors    []*ParseError // Parser が構文解析中に見つけたエラーの情報を保持するための配列
 
 	// これらのマップを用いて、現在読み込んでいるトークンに対応する構文解析関数があるかチェックできる
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
+	prefixParseFns  map[token.TokenType]prefixParseFn
+	infixParseFns   map[token.TokenType]infixParseFn
+	postfixParseFns map[token.TokenType]postfixParseFn
+
+	statementParseFns map[token.TokenType]statementParseFn // 文の先頭のキーワードに対応する構文解析関数。ここにないトークンで始まる文は式文として扱う
+
+	literalHandlers map[string]LiteralHandler // RegisterLiteral で登録した、token.CUSTOM のリテラルを解釈する関数
 }
 
 type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(ast.Expression) ast.Expression // infix構文解析関数は、構文解析中のinfix演算子の「左側の式」を引数にとる
+	prefixParseFn  func() ast.Expression
+	infixParseFn   func(ast.Expression) ast.Expression // infix構文解析関数は、構文解析中のinfix演算子の「左側の式」を引数にとる
+	postfixParseFn func(ast.Expression) ast.Expression // postfix構文解析関数も「左側の式」を引数にとるが、右側の式は持たない
+
+	statementParseFn func() ast.Statement // RegisterStatement で登録する。失敗した時には nil ではなく BadStatement を返す
 )
 
 // Lexer を読み込んで、対応する Parser を生成する
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:               l,
+		errors:          []*ParseError{},
+		literalHandlers: map[string]LiteralHandler{},
 	}
 
-	// New()された時には、prefixParseFnsマップを初期化して,構文解析関数を登録する
+	// New()された時には、構文解析関数のマップを初期化して、parseRules の表にしたがって構文解析関数を登録する
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
-	p.registerPrefix(token.IDENT, p.parseIdentifier)      // トークンタイプ token.IDENT が出現したときに呼び出す構文解析関数はparseIdentifier
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)    // トークンタイプ token.INT が出現したときに呼び出す構文解析関数はparseIntegerLiteral
-	p.registerPrefix(token.BANG, p.parsePrefixExpression) // トークンが前置演算子の時には呼び出す構文解析関数は parsePrefixExpression
-	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
-
-	// New()された時には、infixParseFnsマップを初期化して、構文解析関数を登録する
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
-	// トークンが中置演算子の時に呼び出す構文解析関数は parseInfixExpression
-	p.registerInfix(token.PLUS, p.parseInfixExpression)
-	p.registerInfix(token.MINUS, p.parseInfixExpression)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
-	p.registerInfix(token.EQ, p.parseInfixExpression)
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.postfixParseFns = make(map[token.TokenType]postfixParseFn)
+	for _, rule := range parseRules {
+		rule := rule // クロージャがループ変数ではなく、それぞれのエントリを捕捉するようにする
+		if rule.prefix != nil {
+			p.registerPrefix(rule.tokenType, func() ast.Expression { return rule.prefix(p) })
+		}
+		if rule.infix != nil {
+			p.registerInfix(rule.tokenType, func(left ast.Expression) ast.Expression { return rule.infix(p, left) })
+		}
+		if rule.postfix != nil {
+			p.registerPostfix(rule.tokenType, func(left ast.Expression) ast.Expression { return rule.postfix(p, left) })
+		}
+	}
+	p.statementParseFns = make(map[token.TokenType]statementParseFn)
+	for _, rule := range statementRules {
+		p.RegisterStatement(rule.tokenType, rule.parse)
+	}
 
 	// まずは二つトークンを読み込む。これで curToken と peekToken の両方がセットされたことになる。
 	p.nextToken()
@@ -82,10 +73,40 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// src を一つの式として構文解析する。設定ファイルの条件式などとして、文を含まない式だけを受けつけたい時に使う。
+// 式の後ろには ';' を一つだけ置ける。let などの文や、二つ以上の式がある時はエラーになる。
+// エラーがある時は最初のエラー(*ParseError)を返す
+func ParseExpression(src string) (ast.Expression, error) {
+	p := New(lexer.New(src))
+
+	if p.statementParseFns[p.curToken.Type] != nil {
+		p.addError(p.curToken, UNEXPECTED_STMT, "expected an expression, got %s statement", p.curToken.Literal)
+	}
+
+	var exp ast.Expression
+	if len(p.errors) == 0 {
+		exp = p.parseExpression(LOWEST)
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		if !p.peekTokenIs(token.EOF) && len(p.errors) == 0 {
+			p.peekError(token.EOF)
+		}
+	}
+
+	if errs := p.ErrorList(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return exp, nil
+}
+
 // Parser が現在読んでいるところと次に読むところを一つづつすすめる
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT { // ScanComments モードの Lexer が渡された時でも、コメントは構文解析の対象にしない
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 // トークン列を読み込んだParserに構文解析させるメソッド
@@ -95,27 +116,46 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	// token.EOF に達するまで、入力のトークンを繰り返して読む
 	for p.curToken.Type != token.EOF {
+		errCount := len(p.errors)
 		stmt := p.parseStatement() //現在読んでいるトークンタイプがEOF出ないとき、その文を構文解析してローカル変数 stmt に格納する
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt) // program の Statements フィールドに追加していく
 		}
+		if len(p.errors) > errCount { // この文の構文解析でエラーが起きた時には、次の文の境界まで読み飛ばす
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
+	if validateAfterParse && len(p.ErrorList()) == 0 {
+		if err := ast.Validate(program); err != nil {
+			panic("parser produced an invalid AST: " + err.Error())
+		}
+	}
+
 	return program
 
 }
 
+// 構文解析に失敗した文の残りのトークンを、次の文の境界まで読み飛ばすメソッド
+// 現在のトークンがセミコロンか '}' になるか、次のトークンが文の先頭のキーワード(RegisterStatement で登録したもの)か '}' になったところで止まる。
+// こうしておくと、一つの文の誤りから後続のトークンについてのエラーが連鎖的に報告されることがなくなる
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		if p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) || p.statementParseFns[p.peekToken.Type] != nil {
+			return
+		}
+		p.nextToken()
+	}
+}
+
 // 現座読んでいるトークンの種類によって対応した構文解析をするメソッド
 func (p *Parser) parseStatement() ast.Statement {
-	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
-	case token.RETURN:
-		return p.parseReturnStatement()
-	default: // let文でも,return文でもない時には式文の構文解析を始める
-		return p.parseExpressionStatement()
+	if parse := p.statementParseFns[p.curToken.Type]; parse != nil {
+		return parse()
 	}
+
+	return p.parseExpressionStatement() // 文の構文解析関数が登録されていないトークンで始まる時には式文の構文解析を始める
 }
 
 // let 文の構文を解析するメソッド
@@ -131,8 +171,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// TODO: セミコロンに遭遇するまで式を読み飛ばしてしまっている
-	for !p.curTokenIs(token.SEMICOLON) {
+	p.nextToken() // '=' の次のトークンから右辺の式が始まる
+
+	stmt.Value = p.parseExpression(LOWEST) // 右辺の式を構文解析して、束縛される値として Value フィールドに格納する
+
+	if p.peekTokenIs(token.SEMICOLON) { // 式文と同じく、セミコロンの部分は省略可能
 		p.nextToken()
 	}
 	return stmt
@@ -143,8 +186,9 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	p.nextToken()
 
-	// TODO: セミコロンに遭遇するまで読み飛ばしてしまっている
-	for !p.curTokenIs(token.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST) // 'return' の次の式を構文解析して、返す値として ReturnValue フィールドに格納する
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -165,8 +209,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 // トークンを受け取った時、対応する前置構文解析関数がないときに、Parser のエラーにそのことを追加するメソッド
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, NO_PREFIX_PARSE_FN, "no prefix parse function for %s found", t)
 }
 
 // Parser が現在読んでいるトークンの"前置"に関連づけられた構文解析関数があるか確認し、あるときにはそれを呼び出す
@@ -174,12 +217,18 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type] // 現在読んでいるトークンのタイプに関連づけられた構文解析関数があるとき、それを prefix に保存
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		return p.badExpression(p.curToken)
 	}
 	leftExp := prefix() // 構文解析関数が見つかった時にはそのprefix関数を呼び出し、その結果を返す
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() { //次のトークンがセミコロンではなく、かつ、次のトークンの優先順位が現在の優先順位より高い場合に,以下の処理を繰り返し、これより優先順位の低いトークンに遭遇するまで続ける！！
 
+		if postfix := p.postfixParseFns[p.peekToken.Type]; postfix != nil { // 後置演算子は右側の式を持たないので、演算子のトークンまで進めて左側の式を包むだけでよい
+			p.nextToken()
+			leftExp = postfix(leftExp)
+			continue
+		}
+
 		infix := p.infixParseFns[p.peekToken.Type] // 現在読んでいるトークンの次のトークンに関連づけられた infixParseFn を探す
 		if infix == nil {
 			return leftExp
@@ -202,11 +251,10 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	value, err := strconv.ParseInt(strings.ReplaceAll(p.curToken.Literal, "_", ""), 0, 64) // 1_000 の '_' は区切りなので取り除く
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.addError(p.curToken, INVALID_INTEGER, "could not parse %q as integer", p.curToken.Literal)
+		return p.badExpression(lit.Token)
 	}
 
 	lit.Value = value
@@ -214,6 +262,317 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// Parser が現在読んでいるトークンのリテラル値を float64 にパースして、FloatLiteral ノードを生成する
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		p.addError(p.curToken, INVALID_FLOAT, "could not parse %q as float", p.curToken.Literal)
+		return p.badExpression(lit.Token)
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// Parser が現在読んでいるトークンのリテラルをそのまま Value フィールドに格納した StringLiteral ノードを生成する
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// 現在読んでいるトークンが token.TRUE かどうかで、Boolean ノードの Value フィールドを埋める
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// '(' の次の式を LOWEST から構文解析しなおすことで、括弧の中の式の優先順位を高める
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	start := p.curToken
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) { // 括弧が閉じられていない時には expectPeek がエラーを追加する
+		return p.badExpression(start)
+	}
+
+	return exp
+}
+
+// if (<条件>) { <結果> } else { <代替> } の形のif式を構文解析する。else 以降は省略可能
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return p.badExpression(expression.Token)
+	}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return p.badExpression(expression.Token)
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return p.badExpression(expression.Token)
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return p.badExpression(expression.Token)
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// for (<初期化>; <条件>; <後処理>) { <本体> } の形の for 文を構文解析する。
+// 初期化には let 文を、後処理には式文を使う。三つの部分はどれも省略可能だが、二つの ';' は省略できない
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.LET) {
+		p.nextToken()
+		// let 文のセミコロンは省略可能なので、ここで for 文の一つ目の ';' を読み飛ばさずに残しておく
+		stmt.Init = p.parseLetStatement()
+		if stmt.Init == nil {
+			return nil
+		}
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	} else if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+// '{' から '}' までの文を一つづつ構文解析して、BlockStatement ノードに格納する
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		errCount := len(p.errors)
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		if len(p.errors) > errCount {
+			p.synchronize()
+		}
+		p.nextToken()
+	}
+
+	if p.curTokenIs(token.EOF) { // '}' に出会う前に入力が終わってしまった時はエラーにする
+		p.unterminatedBlockError(block.Token)
+	}
+
+	return block
+}
+
+// fn (<仮引数>) { <本体> } の形の関数リテラルを構文解析する
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return p.badExpression(lit.Token)
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return p.badExpression(lit.Token)
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return p.badExpression(lit.Token)
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// マクロリテラルを構文解析する。キーワードが違うだけで、形は関数リテラルと同じ
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return p.badExpression(lit.Token)
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return p.badExpression(lit.Token)
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return p.badExpression(lit.Token)
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// '(' から ')' までのカンマ区切りの識別子を、関数の仮引数のリストとして構文解析する
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) { // 仮引数が一つもない時
+		p.nextToken()
+		return identifiers
+	}
+
+	p.nextToken()
+
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	identifiers = append(identifiers, ident)
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		identifiers = append(identifiers, ident)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// 現在読んでいるトークンが関数呼び出しの '(' である時に、呼び出される関数の式を受け取って CallExpression ノードを生成する
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return p.badExpression(exp.Token)
+	}
+	return exp
+}
+
+// '[' から ']' までのカンマ区切りの式を構文解析して、ArrayLiteral ノードを生成する
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return p.badExpression(array.Token)
+	}
+
+	return array
+}
+
+// '{' から '}' までのカンマ区切りの <キー>:<値> の組を構文解析して、HashLiteral ノードを生成する
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return p.badExpression(hash.Token)
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs[key] = value
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { // 最後の組の後ろにはカンマを置かない
+			return p.badExpression(hash.Token)
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return p.badExpression(hash.Token)
+	}
+
+	return hash
+}
+
+// カンマ区切りの式を end のトークンに出会うまで構文解析して、スライスにして返す
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) { // 要素が一つもない時
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken() // ',' を読み飛ばして
+		p.nextToken() // 次の要素の先頭に進む
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+// 現在読んでいるトークンが添字演算子の '[' である時に、左側の式を受け取って IndexExpression ノードを生成する
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return p.badExpression(exp.Token)
+	}
+
+	return exp
+}
+
 // 現在読んでいるトークンが前置演算子である時に、そこから適切に PrefixExpression ノードを生成する
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
@@ -237,12 +596,68 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence() // 現在のトークン（中置演算子式の演算子）の優先順位を保存する
+	if rightAssociative[p.curToken.Type] {
+		// 右辺の構文解析で同じ優先順位の演算子も拾わせるために、一段だけ弱い優先順位で右辺を解析する
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence) // トークンを一つ進めてから、parseExpression を呼び出して、このノードのRightフィールドを埋める
 
 	return expression
 }
 
+// <式><演算子> の形の後置演算子式を構文解析する。left は演算子の前までに構文解析した式で、Parser が現在読んでいるトークンは演算子。
+// 後置演算子は被演算子を一つしか取らないので、中置演算子式と違って演算子の後のトークンは読まない
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	return &ast.PostfixExpression{
+		Token:    p.curToken,
+		Left:     left,
+		Operator: p.curToken.Literal,
+	}
+}
+
+// ++x や --x を構文解析する。値を更新できるのは変数だけなので、演算子の右側は識別子でなければならない
+func (p *Parser) parsePrefixUpdateExpression() ast.Expression {
+	expression := p.parsePrefixExpression().(*ast.PrefixExpression)
+	if expression.Right != nil {
+		p.checkUpdateOperand(expression.Token, expression.Right)
+	}
+	return expression
+}
+
+// x++ や x-- を構文解析する。演算子の左側は識別子でなければならない
+func (p *Parser) parsePostfixUpdateExpression(left ast.Expression) ast.Expression {
+	p.checkUpdateOperand(p.curToken, left)
+	return p.parsePostfixExpression(left)
+}
+
+func (p *Parser) checkUpdateOperand(operator token.Token, operand ast.Expression) {
+	switch operand.(type) {
+	case *ast.Identifier:
+	case *ast.BadExpression: // 被演算子の構文解析ですでにエラーになっている
+	default:
+		p.addError(operator, INVALID_OPERAND, "operand of %s must be an identifier, got %s", operator.Literal, operand.String())
+	}
+}
+
+// 構文解析に失敗した式の代わりに木に入れるノードを作る。start はその式の最初のトークンで、直前に記録したエラーを参照する
+func (p *Parser) badExpression(start token.Token) *ast.BadExpression {
+	return &ast.BadExpression{Token: start, Err: p.lastError()}
+}
+
+// 構文解析に失敗した文の代わりに木に入れるノードを作る
+func (p *Parser) badStatement(start token.Token) *ast.BadStatement {
+	return &ast.BadStatement{Token: start, Err: p.lastError()}
+}
+
+// 最後に記録した構文解析のエラーを返す。まだエラーがない時は nil
+func (p *Parser) lastError() error {
+	if len(p.errors) == 0 {
+		return nil // nil の *ParseError を返すと nil ではない error になってしまう
+	}
+	return p.errors[len(p.errors)-1]
+}
+
 // トークンタイプを入力すると、現在 Parser が読んでいるトークンのタイプと一致しているか判定する
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
@@ -264,16 +679,48 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-// Parser が保持しているエラー情報を返す。 テストで使う。
+// Parser が保持しているエラー情報を "行:列: メッセージ" の形の文字列で返す。 テストで使う。字句解析のエラーも先頭に含める
 func (p *Parser) Errors() []string {
-	return p.errors
+	msgs := []string{}
+	for _, err := range p.ErrorList() {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// Parser が保持しているエラー情報を ParseError のまま返す。字句解析のエラーは LEXICAL_ERROR として先頭に含める
+func (p *Parser) ErrorList() []*ParseError {
+	errors := []*ParseError{}
+	for _, err := range p.l.ErrorList() {
+		errors = append(errors, &ParseError{Pos: err.Pos, Code: LEXICAL_ERROR, Message: err.Message})
+	}
+	return append(errors, p.errors...)
 }
 
 // peekToken のタイプが期待に合わない時に、そのトークンのタイプを入力して、エラーメッセージをParserに追加するメソッド
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	err := p.addError(p.peekToken, UNEXPECTED_TOKEN, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	err.Expected = t
+}
+
+// ブロック文が '}' で閉じられないまま EOF に達した時に、エラーメッセージをParserに追加するメソッド
+func (p *Parser) unterminatedBlockError(start token.Token) {
+	err := p.addError(p.curToken, UNTERMINATED_BLOCK, "expected %s to close block opened by %s at %s, got %s instead",
+		token.RBRACE, start.Literal, start.Pos(), token.EOF)
+	err.Expected = token.RBRACE
+}
+
+// エラーの原因になったトークンの位置とタイプを持つ ParseError を生成して、Parserのエラーに追加する
+func (p *Parser) addError(tok token.Token, code ErrorCode, format string, a ...interface{}) *ParseError {
+	err := &ParseError{
+		Pos:     tok.Pos(),
+		Code:    code,
+		Got:     tok.Type,
+		Message: fmt.Sprintf(format, a...),
+	}
+	p.errors = append(p.errors, err)
+	return err
 }
 
 // Parser の prefixParserFns マップにエントリを追加するための補助関数
@@ -285,6 +732,10 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+func (p *Parser) registerPostfix(tokenType token.TokenType, fn postfixParseFn) {
+	p.postfixParseFns[tokenType] = fn
+}
+
 // p.peekTokenのトークンタイプに対応している優先順位を返す
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
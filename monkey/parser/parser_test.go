@@ -4,42 +4,89 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strconv"
+	"strings"
 	"testing"
 )
 
-func TestLetStatements(t *testing.T) {
-	input := `
-	let x = 5;
-	let y = 10;
-	let foobar = 838383;
-	`
-	// inputに対する Lexer と Parser を準備
-	l := lexer.New(input)
-	p := New(l)
+// テストで構文解析したすべての木を ast.Validate で確かめる
+func init() {
+	validateAfterParse = true
+}
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil!")
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = 10;", "y", 10},
+		{"let foobar = y;", "foobar", "y"},
+		{"let flag = true;", "flag", true},
 	}
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
-			len(program.Statements))
+
+	for _, tt := range tests {
+		// inputに対する Lexer と Parser を準備
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+
+		// let文が束縛する右辺の値についてのアサーション
+		val := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
 	}
+}
 
+func TestLetStatementWithInfixExpression(t *testing.T) {
 	tests := []struct {
+		input              string
 		expectedIdentifier string
+		expectedValue      string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"let x = 5 + 5;", "x", "(5 + 5)"},
+		{"let y = -a * b", "y", "((-a) * b)"},
+		{"let z = 1 + 2 * 3 == x;", "z", "((1 + (2 * 3)) == x)"},
 	}
 
-	for i, tt := range tests {
-		stmt := program.Statements[i]
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
 		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if val == nil {
+			t.Fatalf("letStmt.Value is nil")
+		}
+		if val.String() != tt.expectedValue {
+			t.Errorf("letStmt.Value.String() wrong. expected=%q, got=%q",
+				tt.expectedValue, val.String())
+		}
 	}
 }
 
@@ -81,32 +128,41 @@ func checkParserErrors(t *testing.T, p *Parser) {
 }
 
 func TestReturnStatements(t *testing.T) {
-	input := `
-	return 5;
-	return 10;
-	return993322;
-	`
-	l := lexer.New(input)
-	p := New(l)
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return 10;", 10},
+		{"return993322;", 993322},
+		{"return true;", true},
+		{"return foobar", "foobar"},
+	}
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
-			len(program.Statements))
-	}
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
 
-	for _, stmt := range program.Statements {
+		stmt := program.Statements[0]
 		returnStmt, ok := stmt.(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("stmt not *ast.ReturnStatement. got=%T", stmt)
-			continue
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", stmt)
 		}
 		if returnStmt.TokenLiteral() != "return" {
-			t.Errorf("returnStmt.TokenLiteral not 'return', got %q",
+			t.Fatalf("returnStmt.TokenLiteral not 'return', got %q",
 				returnStmt.TokenLiteral())
 		}
+		// return文が返す値についてのアサーション
+		if !testLiteralExpression(t, returnStmt.ReturnValue, tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -168,15 +224,112 @@ func TestIntegerLiteralExpressiont(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralWithUnderscores(t *testing.T) {
+	program := parseSource(t, "1_000_000")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 1000000 {
+		t.Errorf("literal.Value not %d. got=%d", 1000000, literal.Value)
+	}
+	if literal.TokenLiteral() != "1_000_000" { // トークンには書いたとおりのリテラルが残る
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "1_000_000", literal.TokenLiteral())
+	}
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedBoolean bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		boolean, ok := stmt.Expression.(*ast.Boolean)
+		if !ok {
+			t.Fatalf("exp not *ast.Boolean. got=%T", stmt.Expression)
+		}
+		if boolean.Value != tt.expectedBoolean {
+			t.Errorf("boolean.Value not %t. got=%t", tt.expectedBoolean,
+				boolean.Value)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5", 0.5},
+		{"10.0", 10.0},
+		{"1_000.000_5", 1000.0005},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.String() != strings.TrimSuffix(tt.input, ";") {
+			t.Errorf("literal.String() wrong. got=%q", literal.String())
+		}
+	}
+}
+
 // テスト入力のスライスを繰り返して処理して、生成されたASTについてアサーションを設ける
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
-		input        string
-		operator     string
-		integerValue int64
+		input    string
+		operator string
+		value    interface{}
 	}{
 		{"!5", "!", 5},
 		{"-15", "-", 15},
+		{"!true;", "!", true},
+		{"!false;", "!", false},
+		{"++a;", "++", "a"},
+		{"--a;", "--", "a"},
 	}
 
 	for _, tt := range prefixTests {
@@ -205,7 +358,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 			t.Fatalf("exp.Operator is not '%s'. got=%s",
 				tt.operator, exp.Operator)
 		}
-		if !testIntegerLiteral(t, exp.Right, tt.integerValue) { // ヘルパー関数testIntegerLiteralを用いて *ast.PrefixExpression の Right の値が正しい整数リテラルかどうか判定する
+		if !testLiteralExpression(t, exp.Right, tt.value) { // ヘルパー関数testLiteralExpressionを用いて *ast.PrefixExpression の Right の値が正しいリテラルかどうか判定する
 			return
 		}
 	}
@@ -233,18 +386,27 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 func TestParsingInfixExpressions(t *testing.T) {
 	infixTests := []struct {
 		input      string
-		leftValue  int64
+		leftValue  interface{}
 		operator   string
-		rightValue int64
+		rightValue interface{}
 	}{
 		{"5 + 5;", 5, "+", 5},
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
+		{"true == true", true, "==", true},
+		{"true != false", true, "!=", false},
+		{"false == false", false, "==", false},
 	}
 
 	for _, tt := range infixTests {
@@ -270,7 +432,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		}
 
 		// 結果のASTノードのLeftフィールドについてのアサーション
-		if !testIntegerLiteral(t, exp.Left, tt.leftValue) {
+		if !testLiteralExpression(t, exp.Left, tt.leftValue) {
 			return
 		}
 
@@ -279,7 +441,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 				tt.operator, exp.Operator)
 		}
 
-		if !testIntegerLiteral(t, exp.Right, tt.rightValue) {
+		if !testLiteralExpression(t, exp.Right, tt.rightValue) {
 			return
 		}
 	}
@@ -338,6 +500,114 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"1 + 2 <= 3 == 4 >= 5 * 6",
+			"(((1 + 2) <= 3) == (4 >= (5 * 6)))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** -b",
+			"(a ** (-b))",
+		},
+		{
+			"a - b - c ** d ** e",
+			"((a - b) - (c ** (d ** e)))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"x < 1 || x == y && !z",
+			"((x < 1) || ((x == y) && (!z)))",
+		},
+		{
+			"true",
+			"true",
+		},
+		{
+			"false",
+			"false",
+		},
+		{
+			"3 > 5 == false",
+			"((3 > 5) == false)",
+		},
+		{
+			"!true == false",
+			"((!true) == false)",
+		},
+		{
+			"1 + (2 + 3) + 4",
+			"((1 + (2 + 3)) + 4)",
+		},
+		{
+			"(5 + 5) * 2",
+			"((5 + 5) * 2)",
+		},
+		{
+			"2 / (5 + 5)",
+			"(2 / (5 + 5))",
+		},
+		{
+			"-(5 + 5)",
+			"(-(5 + 5))",
+		},
+		{
+			"!(true == true)",
+			"(!(true == true))",
+		},
+		{
+			"((1 + 2) * (3 - 4)) / 5",
+			"(((1 + 2) * (3 - 4)) / 5)",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+		{
+			"a[0][1]",
+			"((a[0])[1])",
+		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -353,3 +623,1337 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 
 }
+
+// 識別子の ASTノードについてのアサーションを行うヘルパー関数
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
+		return false
+	}
+
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %s. got=%s", value, ident.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+// 期待する値の型に応じて、整数リテラルか識別子のヘルパー関数に振り分ける
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+// 真偽値の ASTノードについてのアサーションを行うヘルパー関数
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+
+	if bo.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("bo.TokenLiteral not %t. got=%s", value, bo.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func TestGroupedExpressionMissingRParen(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"(5 + 5", "1:7: expected next token to be ), got EOF instead"},
+		{"(5 + 5;", "1:7: expected next token to be ), got ; instead"},
+		{"((1 + 2) * 3", "1:13: expected next token to be ), got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q. got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative == nil {
+		t.Fatalf("exp.Alternative is nil")
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+// 中置演算子の ASTノードについて、左右の式と演算子のアサーションをまとめて行うヘルパー関数
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
+	operator string, right interface{}) bool {
+
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.InfixExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+
+	return true
+}
+
+func TestBlockStatement(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedStatements []string
+	}{
+		{"if (x) {}", []string{}},
+		{"if (x) { let y = 1; y }", []string{"let y = 1;", "y"}},
+		{"if (x) { 1; 2; 3 }", []string{"1", "2", "3"}},
+		{"if (x) { if (y) { z } }", []string{"ify z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+		}
+
+		block := exp.Consequence
+		if block.TokenLiteral() != "{" {
+			t.Errorf("block.TokenLiteral not '{'. got=%q", block.TokenLiteral())
+		}
+		if len(block.Statements) != len(tt.expectedStatements) {
+			t.Fatalf("block.Statements does not contain %d statements. got=%d",
+				len(tt.expectedStatements), len(block.Statements))
+		}
+		for i, expected := range tt.expectedStatements {
+			if block.Statements[i].String() != expected {
+				t.Errorf("block.Statements[%d] wrong. expected=%q, got=%q",
+					i, expected, block.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestUnterminatedBlockStatement(t *testing.T) {
+	input := "if (x) { let y = 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("parser has %d errors, expected 1. got=%q", len(errors), errors)
+	}
+
+	expected := "1:20: expected } to close block opened by { at 1:8, got EOF instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestLetStatementWithStringLiteral(t *testing.T) {
+	input := `let greeting = "hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0]
+	if !testLetStatement(t, stmt, "greeting") {
+		return
+	}
+
+	literal, ok := stmt.(*ast.LetStatement).Value.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("letStmt.Value not *ast.StringLiteral. got=%T",
+			stmt.(*ast.LetStatement).Value)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestUnterminatedStringLiteral(t *testing.T) {
+	input := `let greeting = "hello`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("parser has %d errors, expected 1. got=%q", len(errors), errors)
+	}
+	if errors[0] != "1:16: unterminated string literal" {
+		t.Errorf("wrong error. expected=%q, got=%q",
+			"1:16: unterminated string literal", errors[0])
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		}
+
+		expectedValue := expected[literal.String()]
+
+		testIntegerLiteral(t, value, expectedValue)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+
+		testFunc(value)
+	}
+}
+
+func TestParsingHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one" 1}`, "1:8: expected next token to be :, got INT instead"},
+		{`{"one": 1 "two": 2}`, "1:11: expected next token to be ,, got STRING instead"},
+		{`{"one": 1`, "1:10: expected next token to be ,, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestErrorPosition(t *testing.T) {
+	input := `let x = 5;
+let y 10;
+let = 3;
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []string{
+		"2:7: expected next token to be =, got INT instead",
+		"3:5: expected next token to be IDENT, got = instead",
+	}
+
+	errors := p.Errors()
+	if len(errors) < len(expected) {
+		t.Fatalf("parser has %d errors, expected at least %d. got=%q",
+			len(errors), len(expected), errors)
+	}
+	if errors[0] != expected[0] {
+		t.Errorf("wrong error. expected=%q, got=%q", expected[0], errors[0])
+	}
+
+	found := false
+	for _, msg := range errors {
+		if msg == expected[1] {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("error %q not found. got=%q", expected[1], errors)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"let x 5; let = 10; let y = 3; let 838383;",
+			[]string{
+				"1:7: expected next token to be =, got INT instead",
+				"1:14: expected next token to be IDENT, got = instead",
+				"1:35: expected next token to be IDENT, got INT instead",
+			},
+			[]string{"<bad statement>", "<bad statement>", "let y = 3;", "<bad statement>"},
+		},
+		{
+			// セミコロンがなくても、次の let で同期する
+			"let x 5 let y = 3",
+			[]string{"1:7: expected next token to be =, got INT instead"},
+			[]string{"<bad statement>", "let y = 3;"},
+		},
+		{
+			// 文の構文解析関数を登録したキーワードならどれでも同期する
+			"let x 5 for (;;) { x }",
+			[]string{"1:7: expected next token to be =, got INT instead"},
+			[]string{"<bad statement>", "for (; ; ) x"},
+		},
+		{
+			"let a = (1 + 2; return a;",
+			[]string{"1:15: expected next token to be ), got ; instead"},
+			[]string{"let a = <bad expression>;", "return a;"},
+		},
+		{
+			// ブロックの中の誤りはブロックの中で同期するので、'}' の後の文は失われない
+			"if (x) { let = 1; y } let z = 2;",
+			[]string{"1:14: expected next token to be IDENT, got = instead"},
+			[]string{"ifx <bad statement>y", "let z = 2;"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%d (%q)",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("errors[%d] wrong for %q. expected=%q, got=%q",
+					i, tt.input, msg, errors[i])
+			}
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d",
+				tt.input, len(tt.expectedStatements), len(program.Statements))
+			continue
+		}
+		for i, expected := range tt.expectedStatements {
+			if program.Statements[i].String() != expected {
+				t.Errorf("statements[%d] wrong for %q. expected=%q, got=%q",
+					i, tt.input, expected, program.Statements[i].String())
+			}
+		}
+	}
+}
+
+func TestBadNodes(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedBad  string // BadExpression か BadStatement の String()
+		expectedCode ErrorCode
+	}{
+		{"let = 1;", "<bad statement>", UNEXPECTED_TOKEN},
+		{"for (x) {}", "<bad statement>", UNEXPECTED_TOKEN},
+		{"1 + ;", "<bad expression>", NO_PREFIX_PARSE_FN},
+		{"(1 + 2", "<bad expression>", UNEXPECTED_TOKEN},
+		{"if (x { y }", "<bad expression>", UNEXPECTED_TOKEN},
+		{"fn(x, y { x }", "<bad expression>", UNEXPECTED_TOKEN},
+		{"f(1, 2", "<bad expression>", UNEXPECTED_TOKEN},
+		{"[1, 2", "<bad expression>", UNEXPECTED_TOKEN},
+		{"a[1", "<bad expression>", UNEXPECTED_TOKEN},
+		{"99999999999999999999", "<bad expression>", INVALID_INTEGER},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.ErrorList()) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+
+		// エラーがあっても木の中に nil はなく、String() は panic しない
+		bad := findBadNode(program)
+		if bad == nil {
+			t.Errorf("no bad node for %q. program=%q", tt.input, program.String())
+			continue
+		}
+		if bad.String() != tt.expectedBad {
+			t.Errorf("wrong bad node for %q. expected=%q, got=%q", tt.input, tt.expectedBad, bad.String())
+		}
+
+		var err error
+		switch bad := bad.(type) {
+		case *ast.BadExpression:
+			err = bad.Err
+		case *ast.BadStatement:
+			err = bad.Err
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("bad node for %q does not refer to a *ParseError. got=%T", tt.input, err)
+			continue
+		}
+		if parseErr.Code != tt.expectedCode {
+			t.Errorf("wrong error code for %q. expected=%s, got=%s", tt.input, tt.expectedCode, parseErr.Code)
+		}
+	}
+}
+
+// TestBadNodes の入力に出てくるノードだけをたどって、最初に見つかった BadExpression か BadStatement を返す
+func findBadNode(node ast.Node) ast.Node {
+	var found ast.Node
+	var walk func(n ast.Node)
+	walk = func(n ast.Node) {
+		if found != nil || n == nil {
+			return
+		}
+		switch n := n.(type) {
+		case *ast.BadExpression, *ast.BadStatement:
+			found = n
+		case *ast.Program:
+			for _, s := range n.Statements {
+				walk(s)
+			}
+		case *ast.BlockStatement:
+			for _, s := range n.Statements {
+				walk(s)
+			}
+		case *ast.ExpressionStatement:
+			walk(n.Expression)
+		case *ast.LetStatement:
+			walk(n.Value)
+		case *ast.InfixExpression:
+			walk(n.Left)
+			walk(n.Right)
+		}
+	}
+	walk(node)
+	return found
+}
+
+func TestErrorList(t *testing.T) {
+	input := `let x 5;
+"abc`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	tests := []struct {
+		expectedPos      token.Position
+		expectedCode     ErrorCode
+		expectedExpected token.TokenType
+		expectedGot      token.TokenType
+		expectedMessage  string
+	}{
+		{token.Position{Line: 2, Column: 1}, LEXICAL_ERROR, "", "", "unterminated string literal"},
+		{token.Position{Line: 1, Column: 7}, UNEXPECTED_TOKEN, token.ASSIGN, token.INT,
+			"expected next token to be =, got INT instead"},
+	}
+
+	errors := p.ErrorList()
+	if len(errors) != len(tests) {
+		t.Fatalf("parser has %d errors, expected %d. got=%q",
+			len(errors), len(tests), p.Errors())
+	}
+
+	for i, tt := range tests {
+		err := errors[i]
+		if err.Pos != tt.expectedPos {
+			t.Errorf("errors[%d].Pos wrong. expected=%s, got=%s", i, tt.expectedPos, err.Pos)
+		}
+		if err.Code != tt.expectedCode {
+			t.Errorf("errors[%d].Code wrong. expected=%q, got=%q", i, tt.expectedCode, err.Code)
+		}
+		if err.Expected != tt.expectedExpected {
+			t.Errorf("errors[%d].Expected wrong. expected=%q, got=%q",
+				i, tt.expectedExpected, err.Expected)
+		}
+		if err.Got != tt.expectedGot {
+			t.Errorf("errors[%d].Got wrong. expected=%q, got=%q", i, tt.expectedGot, err.Got)
+		}
+		if err.Message != tt.expectedMessage {
+			t.Errorf("errors[%d].Message wrong. expected=%q, got=%q",
+				i, tt.expectedMessage, err.Message)
+		}
+	}
+
+	// 文字列の形では位置がメッセージの先頭につく
+	if p.Errors()[1] != "1:7: expected next token to be =, got INT instead" {
+		t.Errorf("Errors()[1] wrong. got=%q", p.Errors()[1])
+	}
+}
+
+func TestParsingWithComments(t *testing.T) {
+	input := `let x = 1 + /* two */ 2; // three
+x`
+
+	// コメントを token.COMMENT として返す Lexer を渡しても、構文解析の結果は変わらない
+	for _, l := range []*lexer.Lexer{lexer.New(input), lexer.NewWithMode(input, lexer.ScanComments)} {
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != "let x = (1 + 2);x" {
+			t.Errorf("program.String() wrong. got=%q", program.String())
+		}
+	}
+}
+
+func TestCustomLiterals(t *testing.T) {
+	kilobytes := func(literal string) (ast.Expression, error) {
+		n, err := strconv.ParseInt(strings.TrimSuffix(literal, "kb"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("size must be an integer")
+		}
+		return ast.NewInt(n * 1024), nil
+	}
+	color := func(literal string) (ast.Expression, error) {
+		v, err := strconv.ParseUint(literal[1:], 16, 32)
+		if err != nil || len(literal) != 7 {
+			return nil, fmt.Errorf("color must have 6 hex digits")
+		}
+		return ast.NewArray(ast.NewInt(int64(v>>16)), ast.NewInt(int64(v>>8&0xff)), ast.NewInt(int64(v&0xff))), nil
+	}
+
+	p := New(lexer.New(`let size = 10kb + 1; #ff0080`))
+	p.RegisterLiteral("kb", kilobytes)
+	p.RegisterLiteral("#", color)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let size = (10240 + 1);[255, 0, 128]" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	tests := []struct {
+		input           string
+		expectedCode    ErrorCode
+		expectedMessage string
+	}{
+		{"5s", UNKNOWN_LITERAL, `1:1: no literal handler registered for "s" in 5s`},
+		{"x + 1.5kb", INVALID_LITERAL, "1:5: could not parse 1.5kb: size must be an integer"},
+		{"#fff", INVALID_LITERAL, "1:1: could not parse #fff: color must have 6 hex digits"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.RegisterLiteral("kb", kilobytes)
+		p.RegisterLiteral("#", color)
+		p.ParseProgram()
+
+		errors := p.ErrorList()
+		if len(errors) != 1 {
+			t.Errorf("parser has %d errors for %q, expected 1. got=%q", len(errors), tt.input, p.Errors())
+			continue
+		}
+		if errors[0].Code != tt.expectedCode {
+			t.Errorf("error code wrong for %q. expected=%q, got=%q", tt.input, tt.expectedCode, errors[0].Code)
+		}
+		if errors[0].Error() != tt.expectedMessage {
+			t.Errorf("error wrong for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errors[0].Error())
+		}
+	}
+}
+
+func TestUpdateExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a++", "(a++)"},
+		{"a--", "(a--)"},
+		{"a++ + ++b", "((a++) + (++b))"},
+		{"-a++", "(-(a++))"},
+		{"a-- * 2", "((a--) * 2)"},
+		{"for (let i = 0; i < 3; i++) { i }", "for (let i = 0; (i < 3); (i++)) i"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestUpdateExpressionInvalidOperand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5++", "1:2: operand of ++ must be an identifier, got 5"},
+		{"--(a + b)", "1:1: operand of -- must be an identifier, got (a + b)"},
+		{"++a[0]", "1:1: operand of ++ must be an identifier, got (a[0])"},
+		{"++a++", "1:1: operand of ++ must be an identifier, got (a++)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.ErrorList()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q. got=%v", tt.input, p.Errors())
+			continue
+		}
+		if errors[0].Code != INVALID_OPERAND {
+			t.Errorf("wrong error code for %q. got=%s", tt.input, errors[0].Code)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	p := New(lexer.New(""))
+
+	for _, rule := range parseRules {
+		if rule.prefix == nil && rule.infix == nil && rule.postfix == nil {
+			t.Errorf("rule for %s has no parse function", rule.tokenType)
+		}
+		// 式の後ろに出現したトークンを中置演算子と後置演算子のどちらとして扱うか決められなくなる
+		if rule.infix != nil && rule.postfix != nil {
+			t.Errorf("rule for %s has both infix and postfix", rule.tokenType)
+		}
+		if rule.prefix != nil && p.prefixParseFns[rule.tokenType] == nil {
+			t.Errorf("prefix parse function for %s is not registered", rule.tokenType)
+		}
+		if rule.infix != nil && p.infixParseFns[rule.tokenType] == nil {
+			t.Errorf("infix parse function for %s is not registered", rule.tokenType)
+		}
+		if rule.postfix != nil && p.postfixParseFns[rule.tokenType] == nil {
+			t.Errorf("postfix parse function for %s is not registered", rule.tokenType)
+		}
+		if rule.infix == nil && rule.postfix == nil {
+			continue
+		}
+		// 式の後ろに出現するトークンは LOWEST より強く結びつかないと、parseExpression のループで拾われない
+		if rule.precedence <= LOWEST {
+			t.Errorf("rule for %s has precedence %d", rule.tokenType, rule.precedence)
+		}
+		if precedences[rule.tokenType] != rule.precedence {
+			t.Errorf("precedences[%s] wrong. expected=%d, got=%d",
+				rule.tokenType, rule.precedence, precedences[rule.tokenType])
+		}
+	}
+}
+
+func TestStatementRules(t *testing.T) {
+	p := New(lexer.New(""))
+
+	for _, rule := range statementRules {
+		if p.statementParseFns[rule.tokenType] == nil {
+			t.Errorf("statement parse function for %s is not registered", rule.tokenType)
+		}
+	}
+
+	// 登録した構文解析関数は、そのトークンで始まる文に使われる
+	p = New(lexer.New("if; 1"))
+	p.RegisterStatement(token.IF, func(p *Parser) ast.Statement {
+		stmt := &ast.ReturnStatement{
+			Token:       p.curToken,
+			ReturnValue: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0"}, Value: 0},
+		}
+		p.expectPeek(token.SEMICOLON) // 他の文と同じく、文の最後のトークンまで進めておく
+		return stmt
+	})
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "if 0;1" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestParsingPostfixExpressions(t *testing.T) {
+	// まだ表に後置演算子がないので、テストの間だけ '!' を後置演算子として登録する
+	precedences[token.BANG] = POSTFIX
+	defer delete(precedences, token.BANG)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a!", "(a!)"},
+		{"a!!", "((a!)!)"},
+		{"-a!", "(-(a!))"},
+		{"a! * b", "((a!) * b)"},
+		{"a + b!", "(a + (b!))"},
+		{"a[0]!", "((a[0])!)"},
+		{"f(x)!", "(f(x)!)"},
+		{"!a!", "(!(a!))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.registerPostfix(token.BANG, p.parsePostfixExpression)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i + 1) { x }", "for (let i = 0; (i < 10); (i + 1)) x"},
+		{"for (; i < 10; ) { x; y }", "for (; (i < 10); ) xy"},
+		{"for (;;) {}", "for (; ; ) "},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestForStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0 i < 10; i) {}", "1:16: expected next token to be ;, got IDENT instead"},
+		{"for (; i < 10) {}", "1:14: expected next token to be ;, got ) instead"},
+		{"for (;;) x", "1:10: expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"x > 10 && y;", "((x > 10) && y)"},
+		{"fn(x) { let y = x; y }(1)", "fn(x) let y = x;y(1)"}, // 関数本体の中の文はかまわない
+	}
+
+	for _, tt := range tests {
+		exp, err := ParseExpression(tt.input)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("ParseExpression(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode ErrorCode
+		expected     string
+	}{
+		{"let x = 1", UNEXPECTED_STMT, "1:1: expected an expression, got let statement"},
+		{"return 1", UNEXPECTED_STMT, "1:1: expected an expression, got return statement"},
+		{"1; 2", UNEXPECTED_TOKEN, "1:4: expected next token to be EOF, got INT instead"},
+		{"1 2", UNEXPECTED_TOKEN, "1:3: expected next token to be EOF, got INT instead"},
+		{"1;;", UNEXPECTED_TOKEN, "1:3: expected next token to be EOF, got ; instead"},
+		{"", NO_PREFIX_PARSE_FN, "1:1: no prefix parse function for EOF found"},
+		{"(1 + ", NO_PREFIX_PARSE_FN, "1:6: no prefix parse function for EOF found"},
+		{`"abc`, LEXICAL_ERROR, "1:1: unterminated string literal"},
+	}
+
+	for _, tt := range tests {
+		exp, err := ParseExpression(tt.input)
+		if err == nil {
+			t.Errorf("ParseExpression(%q) returned no error. got=%q", tt.input, exp.String())
+			continue
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("error is not *ParseError. got=%T", err)
+			continue
+		}
+		if parseErr.Code != tt.expectedCode {
+			t.Errorf("wrong error code for %q. expected=%s, got=%s", tt.input, tt.expectedCode, parseErr.Code)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// ast.Source で書き出したソースコードを構文解析すると、元と同じ木になる
+func TestSourceRoundTrip(t *testing.T) {
+	inputs := []string{
+		`let x = 5; let y = x * 2 + 1; y;`,
+		`-a * b ** 2 ** 3 % 4 - !true`,
+		`a + b * c + d / e - f == 3 > 4 != 3 < 4 && x <= 1 || y >= 2`,
+		`let add = fn(a, b) { return a + b; }; add(1, add(2, 3));`,
+		`fn(x) { x }(5)`,
+		`if (x < y) { x } else { let z = y; z }`,
+		`[1, "two\n\"2\"", 3.5][1 + 1]; {true: fn() {}}`, // ハッシュの String() は組の順序が決まらないので、組は一つにする
+		`for (let i = 0; i < 10; i++) { puts(i); --i; i-- } for (;;) {} 1`,
+		`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };`,
+		`let 名前 = "\u{1F600}\t"; 名前`,
+	}
+
+	for _, input := range inputs {
+		program := parseSource(t, input)
+		src, err := ast.Source(program)
+		if err != nil {
+			t.Errorf("ast.Source(%q) returned error: %v", input, err)
+			continue
+		}
+
+		reparsed := parseSource(t, src)
+		if reparsed.String() != program.String() {
+			t.Errorf("tree changed after round trip of %q.\nsource=%q\nexpected=%q\ngot=%q",
+				input, src, program.String(), reparsed.String())
+		}
+	}
+
+	// 組み立てた木も、書き出して構文解析すると同じ木になる
+	built := ast.NewProgram(
+		ast.NewLet("double", ast.NewFunction([]string{"n"}, ast.NewBlock(
+			ast.NewReturn(ast.NewInfix(ast.NewIdent("n"), "*", ast.NewInt(2))),
+		))),
+		ast.NewExpressionStatement(ast.NewCall(ast.NewIdent("double"), ast.NewInfix(ast.NewInt(1), "+", ast.NewInt(2)))),
+	)
+	src, err := ast.Source(built)
+	if err != nil {
+		t.Fatalf("ast.Source returned error: %v", err)
+	}
+	if reparsed := parseSource(t, src); reparsed.String() != built.String() {
+		t.Errorf("built tree changed after round trip.\nsource=%q\nexpected=%q\ngot=%q", src, built.String(), reparsed.String())
+	}
+}
+
+func parseSource(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	return program
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// 演算子の優先順位を決める部分
+const (
+	_ int = iota
+	LOWEST
+	OR          // ||
+	AND         // &&
+	EQUALS      // ==
+	LESSGREATER // > or <
+	SUM         // +
+	PRODUCT     // * or / or %
+	PREFIX      //  -X or !X
+	POWER       // X ** Y。-X ** Y が -(X ** Y) になるように前置演算子よりも強く結びつける
+	POSTFIX     // X++
+	CALL        // myfunction(X)
+	INDEX       // array[index]
+)
+
+// 中置演算子の結合性
+type associativity int
+
+const (
+	leftAssoc  associativity = iota // a - b - c は ((a - b) - c)
+	rightAssoc                      // a ** b ** c は (a ** (b ** c))
+)
+
+// トークンのタイプごとの構文解析の規則。
+// 式の先頭に出現した時の構文解析関数(prefix)と、式の後ろに出現した時の構文解析関数(infix か postfix のどちらか一方)、
+// 式の後ろに出現した時の優先順位と結合性を持つ
+type parseRule struct {
+	tokenType     token.TokenType
+	prefix        func(*Parser) ast.Expression
+	infix         func(*Parser, ast.Expression) ast.Expression
+	postfix       func(*Parser, ast.Expression) ast.Expression
+	precedence    int // infix か postfix として使われる時の優先順位。どちらもない時は使われない
+	associativity associativity
+}
+
+// 式の構文解析の規則の表。演算子を追加する時はここにエントリを一つ追加すればよい。
+// New() はこの表から構文解析関数を登録し、優先順位の表 precedences もこの表から作られる
+var parseRules []parseRule
+
+// トークンのタイプとその優先順位を関連づけるテーブル
+var precedences = map[token.TokenType]int{}
+
+// 右結合の中置演算子のトークンのタイプの集合。ここにないものは左結合として扱う
+var rightAssociative = map[token.TokenType]bool{}
+
+// 文の先頭のキーワードごとの構文解析の規則
+type statementRule struct {
+	tokenType token.TokenType
+	parse     StatementHandler
+}
+
+// 文の構文解析の規則の表。キーワードで始まる文を追加する時はここにエントリを一つ追加すればよい
+var statementRules []statementRule
+
+// 表のエントリが Parser のメソッドを参照し、そのメソッドが precedences を参照するので、
+// 変数の初期化式ではなく init() の中で表を作る(初期化式で作ると初期化の循環になってしまう)
+func init() {
+	parseRules = []parseRule{
+		// リテラルと識別子
+		{tokenType: token.IDENT, prefix: (*Parser).parseIdentifier},
+		{tokenType: token.INT, prefix: (*Parser).parseIntegerLiteral},
+		{tokenType: token.FLOAT, prefix: (*Parser).parseFloatLiteral},
+		{tokenType: token.STRING, prefix: (*Parser).parseStringLiteral},
+		{tokenType: token.CUSTOM, prefix: (*Parser).parseCustomLiteral}, // 登録していないリテラルもここでエラーにする
+		{tokenType: token.TRUE, prefix: (*Parser).parseBoolean},
+		{tokenType: token.FALSE, prefix: (*Parser).parseBoolean},
+		{tokenType: token.IF, prefix: (*Parser).parseIfExpression},
+		{tokenType: token.FUNCTION, prefix: (*Parser).parseFunctionLiteral},
+		{tokenType: token.MACRO, prefix: (*Parser).parseMacroLiteral},
+		{tokenType: token.LBRACE, prefix: (*Parser).parseHashLiteral},
+
+		// 前置演算子としても中置演算子としても使われるトークン
+		{tokenType: token.BANG, prefix: (*Parser).parsePrefixExpression},
+		{tokenType: token.MINUS, prefix: (*Parser).parsePrefixExpression, infix: (*Parser).parseInfixExpression, precedence: SUM},
+		{tokenType: token.LPAREN, prefix: (*Parser).parseGroupedExpression, infix: (*Parser).parseCallExpression, precedence: CALL},                       // グループ化と関数呼び出し
+		{tokenType: token.INCREMENT, prefix: (*Parser).parsePrefixUpdateExpression, postfix: (*Parser).parsePostfixUpdateExpression, precedence: POSTFIX}, // ++x と x++
+		{tokenType: token.DECREMENT, prefix: (*Parser).parsePrefixUpdateExpression, postfix: (*Parser).parsePostfixUpdateExpression, precedence: POSTFIX}, // --x と x--
+		{tokenType: token.LBRACKET, prefix: (*Parser).parseArrayLiteral, infix: (*Parser).parseIndexExpression, precedence: INDEX},                        // 配列リテラルと添字演算子
+
+		// 中置演算子
+		{tokenType: token.OR, infix: (*Parser).parseInfixExpression, precedence: OR},
+		{tokenType: token.AND, infix: (*Parser).parseInfixExpression, precedence: AND},
+		{tokenType: token.EQ, infix: (*Parser).parseInfixExpression, precedence: EQUALS},
+		{tokenType: token.NOT_EQ, infix: (*Parser).parseInfixExpression, precedence: EQUALS},
+		{tokenType: token.LT, infix: (*Parser).parseInfixExpression, precedence: LESSGREATER},
+		{tokenType: token.GT, infix: (*Parser).parseInfixExpression, precedence: LESSGREATER},
+		{tokenType: token.LT_EQ, infix: (*Parser).parseInfixExpression, precedence: LESSGREATER},
+		{tokenType: token.GT_EQ, infix: (*Parser).parseInfixExpression, precedence: LESSGREATER},
+		{tokenType: token.PLUS, infix: (*Parser).parseInfixExpression, precedence: SUM},
+		{tokenType: token.ASTERISK, infix: (*Parser).parseInfixExpression, precedence: PRODUCT},
+		{tokenType: token.SLASH, infix: (*Parser).parseInfixExpression, precedence: PRODUCT},
+		{tokenType: token.PERCENT, infix: (*Parser).parseInfixExpression, precedence: PRODUCT},
+		{tokenType: token.POWER, infix: (*Parser).parseInfixExpression, precedence: POWER, associativity: rightAssoc},
+	}
+
+	// 失敗した時は、nil の代わりに BadStatement を木に入れる
+	statementRules = []statementRule{
+		{token.LET, func(p *Parser) ast.Statement {
+			start := p.curToken
+			if stmt := p.parseLetStatement(); stmt != nil {
+				return stmt
+			}
+			return p.badStatement(start)
+		}},
+		{token.RETURN, func(p *Parser) ast.Statement { return p.parseReturnStatement() }},
+		{token.FOR, func(p *Parser) ast.Statement {
+			start := p.curToken
+			if stmt := p.parseForStatement(); stmt != nil {
+				return stmt
+			}
+			return p.badStatement(start)
+		}},
+	}
+
+	for _, rule := range parseRules {
+		if rule.infix != nil || rule.postfix != nil {
+			precedences[rule.tokenType] = rule.precedence
+			if rule.associativity == rightAssoc {
+				rightAssociative[rule.tokenType] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// 文の先頭のトークンに対応する構文解析関数。呼ばれた時には p.CurToken() がそのトークンになっている。
+// 他の文の構文解析関数と同じく、文の最後のトークン(';' があればそれ)まで読み進めてから返す。
+// 失敗した時は nil を返せばよい。木にはその代わりに BadStatement が入る
+type StatementHandler func(p *Parser) ast.Statement
+
+// tokenType のトークンで始まる文を構文解析する関数を登録する。let や return などの組み込みの文も同じ仕組みで登録していて、
+// 同じトークンに登録すると組み込みの文を置き換える。ここに登録していないトークンで始まる文は式文として扱う。
+//
+// 登録したトークンは文の境界としても使われる。ある文の構文解析でエラーが起きると、synchronize は
+// 次のトークンが登録したトークンになったところで読み飛ばすのをやめ、そこから次の文として構文解析を続ける。
+// そのため、式の途中にも現れるトークン(token.IDENT など)を登録すると、エラーの後で式の途中から文を読み直すことになる
+func (p *Parser) RegisterStatement(tokenType token.TokenType, handler StatementHandler) {
+	p.statementParseFns[tokenType] = func() ast.Statement {
+		start := p.curToken
+		if stmt := handler(p); !ast.IsNil(stmt) {
+			return stmt
+		}
+		return p.badStatement(start)
+	}
+}
+
+// 現在読んでいるトークンを返す。StatementHandler から使う
+func (p *Parser) CurToken() token.Token {
+	return p.curToken
+}
+
+// 次のトークンを読む。StatementHandler から使う
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+// 次のトークンのタイプが t の時はそこまで読み進めて true を返す。違う時は構文解析のエラーを記録して false を返す。
+// StatementHandler から使う
+func (p *Parser) ExpectPeek(t token.TokenType) bool {
+	return p.expectPeek(t)
+}
+
+// 現在のトークンから始まる式を構文解析する。precedence より強く結合する演算子だけを式に含める。
+// 文の中の式全体を読む時は LOWEST を渡す。StatementHandler から使う
+func (p *Parser) ParseExpressionAt(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
@@ -0,0 +1,63 @@
+package parser_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"testing"
+)
+
+// `if 条件;` を assert(条件) の呼び出しの式文として読む。条件の後の ';' は必須
+func parseAssert(p *parser.Parser) ast.Statement {
+	tok := p.CurToken()
+	p.NextToken()
+	condition := p.ParseExpressionAt(parser.LOWEST)
+	if !p.ExpectPeek(token.SEMICOLON) {
+		return nil
+	}
+	return &ast.ExpressionStatement{
+		Token:      tok,
+		Expression: &ast.CallExpression{Token: tok, Function: ast.NewIdent("assert"), Arguments: []ast.Expression{condition}},
+	}
+}
+
+func TestRegisterStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   int
+	}{
+		{"if x > 0; 1", "assert((x > 0))1", 0},
+		{"if x; if y;", "assert(x)assert(y)", 0},
+		// 失敗した時は BadStatement が木に入る
+		{"if x 1", "<bad statement>", 1},
+		// 登録したトークンは文の境界になるので、前の文のエラーから if の前で立ち直る
+		{"let = 5 if x;", "<bad statement>assert(x)", 1},
+		// 置き換えていない組み込みの文はそのまま使える
+		{"let a = 1; if a;", "let a = 1;assert(a)", 0},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.RegisterStatement(token.IF, parseAssert)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.errors {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%q", tt.input, tt.errors, p.Errors())
+		}
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestRegisterStatementWithoutSynchronize(t *testing.T) {
+	// 登録していなければ if は文の境界ではないので、let のエラーの後で文の最後まで読み飛ばされる
+	p := parser.New(lexer.New("let = 5 if x;"))
+	program := p.ParseProgram()
+
+	if program.String() != "<bad statement>" {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", "<bad statement>", program.String())
+	}
+}
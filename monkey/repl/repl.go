@@ -4,27 +4,143 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/builtins"
+	"monkey/evaluator"
 	"monkey/lexer"
-	"monkey/token"
+	"monkey/object"
+	"monkey/optimizer"
+	"monkey/parser"
+	"runtime/debug"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+const MONKEY_FACE = `            __,__
+   .--.  .-"     "-.  .--.
+  / .. \/  .-. .-.  \/ .. \
+ | |  '|  /   Y   \  |'  | |
+ | \   \  \ 0 | 0 /  /   / |
+  \ '- ,\.-"""""""-./, -' /
+   ''-' /_   ^ ^   _\ '-''
+       |  \._   _./  |
+       \   \ '~' /   /
+        '._ '-=-' _.'
+           '-----'
+`
+
+// 入力を一行づつ読み込んで、字句解析・構文解析・評価をして、その結果を出力する
 func Start(in io.Reader, out io.Writer) {
+	StartWithOptimizer(in, out, optimizer.New(optimizer.O0))
+}
+
+// Start と同じだが、マクロを展開した後の木を opt で最適化してから評価する
+func StartWithOptimizer(in io.Reader, out io.Writer, opt *optimizer.Optimizer) {
 	scanner := bufio.NewScanner(in)
+	env := evaluator.NewEnvironment() // let で束縛した値を次の行でも使えるように、環境は REPL 全体で一つだけ用意する
+	env.SetOutput(out)                // puts の出力も結果と同じところに書き出す
+	macroEnv := object.NewEnvironment()
 
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 
 		line := scanner.Text()
+		if strings.HasPrefix(line, ":doc") { // :doc <名前> で組み込み関数の説明を表示する
+			printDoc(out, strings.TrimSpace(strings.TrimPrefix(line, ":doc")))
+			continue
+		}
+
 		l := lexer.New(line)
+		p := parser.New(l)
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			continue
 		}
+
+		evalProgram(out, program, env, macroEnv, opt)
+	}
+}
+
+// マクロを展開して最適化してから評価して、結果を出力する。
+// 評価器のバグで panic しても REPL を終わらせないように、ここで recover して診断を出力する。
+// 環境はそのまま残るので、それまでに束縛した値は次の行でも使える
+func evalProgram(out io.Writer, program *ast.Program, env, macroEnv *object.Environment, opt *optimizer.Optimizer) {
+	defer func() {
+		if r := recover(); r != nil {
+			printInternalError(out, r, debug.Stack())
+		}
+	}()
+
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		io.WriteString(out, err.Inspect())
+		io.WriteString(out, "\n")
+		return
+	}
+	optimized := opt.Optimize(expanded.(*ast.Program))
+
+	evaluated := evaluator.Eval(optimized, env)
+	if isError(evaluated) || hasValue(optimized) {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
+}
+
+// 最後の文が値を持つかどうか。let 文と for 文は NULL に評価されるが、REPL では何も出力しない
+func hasValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.LetStatement, *ast.ForStatement:
+		return false
+	default:
+		return true
+	}
+}
+
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
+// recover した panic の値と Go のスタックトレースを、バグの報告に使えるように出力する
+func printInternalError(out io.Writer, r interface{}, stack []byte) {
+	fmt.Fprintf(out, "internal error: %v\n", r)
+	io.WriteString(out, "This is a bug in the interpreter. Please report it with the following stack trace:\n")
+	out.Write(stack)
+}
+
+// 組み込み関数の説明を出力する。名前を省略した時は、説明を見られる組み込み関数の名前を一覧にして出力する
+func printDoc(out io.Writer, name string) {
+	if name == "" {
+		io.WriteString(out, "usage: :doc <name>\n")
+		io.WriteString(out, "builtins: "+strings.Join(builtins.Names(), ", ")+"\n")
+		return
+	}
+
+	doc, ok := builtins.Doc(name)
+	if !ok {
+		io.WriteString(out, "no builtin function named "+name+"\n")
+		return
+	}
+	io.WriteString(out, doc)
+}
+
+// 構文解析のエラーを、それとわかるバナーをつけて出力する
+func printParserErrors(out io.Writer, errors []string) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(out, " parser errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
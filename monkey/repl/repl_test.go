@@ -0,0 +1,204 @@
+package repl
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/optimizer"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	input := "let x = 5;\nlet add = fn(a, b) { a + b };\nadd(x, 10)\nx == 5\nif (x > 10) { x }\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// let 文は値を出力しないので、プロンプトだけが続く。値のない式は null を出力する
+	expected := ">> >> >> 15\n>> true\n>> null\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartLoadsPrelude(t *testing.T) {
+	input := "map(filter([1, 2, 3], fn(x) { x > 1 }), fn(x) { x * 10 })\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> [20, 30]\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartWithOptimizer(t *testing.T) {
+	input := "let f = fn(x) { x * (60 * 60) };\nf(2)\n"
+
+	var out, dump bytes.Buffer
+	opt := optimizer.New(optimizer.O1)
+	opt.SetDump(&dump)
+	StartWithOptimizer(strings.NewReader(input), &out, opt)
+
+	expected := ">> >> 7200\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+	// マクロを展開した後の木が、行ごとに最適化される
+	if !strings.Contains(dump.String(), "let f = fn(x) (x * 3600);") {
+		t.Errorf("program was not optimized. dump=%q", dump.String())
+	}
+}
+
+func TestStartPrintsParserErrors(t *testing.T) {
+	input := "let = 5;\n1 + 1\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	got := out.String()
+	if !strings.Contains(got, "Woops! We ran into some monkey business here!") {
+		t.Errorf("output does not contain the error banner. got=%q", got)
+	}
+	if !strings.Contains(got, "\t1:5: expected next token to be IDENT, got = instead\n") {
+		t.Errorf("output does not contain the parser error. got=%q", got)
+	}
+	// エラーの後も REPL は続き、次の行を評価する
+	if !strings.HasSuffix(got, ">> 2\n>> ") {
+		t.Errorf("REPL did not continue after the parser error. got=%q", got)
+	}
+}
+
+func TestStartPuts(t *testing.T) {
+	input := `puts("hello", 1 + 2)` + "\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// puts は引数を一行づつ出力して、null を返す
+	expected := ">> hello\n3\nnull\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartMacros(t *testing.T) {
+	// 前の行で定義したマクロを次の行で使える
+	input := "let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\n" +
+		"unless(1 > 2, 10, 20)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> >> 10\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartDoc(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":doc len", "len(value)\n    Returns the number of bytes in a string or the number of elements in an array.\n"},
+		{":doc  push ", "push(array, value)\n    Returns a new array with value appended. The given array is not modified.\n"},
+		{":doc nothing", "no builtin function named nothing\n"},
+		{":doc", "usage: :doc <name>\nbuiltins: builtins, first, help, last, len, push, puts, rest, version\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input+"\n"), &out)
+
+		expected := PROMPT + tt.expected + PROMPT
+		if out.String() != expected {
+			t.Errorf("output wrong for %q. expected=%q, got=%q", tt.input, expected, out.String())
+		}
+	}
+}
+
+func TestStartReportsMacroErrors(t *testing.T) {
+	// 引用を返さないマクロはエラーになるが、REPL は続き、それまでの束縛も残っている
+	input := "let x = 5;\n" +
+		"let m = macro() { 1 };\n" +
+		"m()\n" +
+		"x + 1\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> >> >> ERROR: macro must return a quoted node, got INTEGER\n\tat m (1:2)\n>> 6\n>> "
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestEvalProgramRecoversFromPanic(t *testing.T) {
+	// 式のない式文のように構文解析器が作らない木を評価すると、評価器は panic する
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{}}}
+
+	var out bytes.Buffer
+	evalProgram(&out, program, evaluator.NewEnvironment(), object.NewEnvironment(), optimizer.New(optimizer.O0))
+
+	output := out.String()
+	if !strings.HasPrefix(output, "internal error: ") {
+		t.Errorf("output does not contain the panic value. got=%q", output)
+	}
+	if !strings.Contains(output, "goroutine ") {
+		t.Errorf("output does not contain the Go stack trace. got=%q", output)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		src            string
+		expectedOK     bool
+		expectedOut    string
+		expectedErrOut string
+	}{
+		{
+			"let add = fn(a, b) { a + b };\nputs(add(1, 2));\nadd(3, 4)\n",
+			true, "3\n", "", // 最後の式の値は出力しない
+		},
+		{
+			"puts(reduce(map([1, 2, 3], fn(x) { x * x }), 0, fn(a, b) { a + b }))",
+			true, "14\n", "",
+		},
+		{
+			"let x 5;\nlet = 3;\n\"abc",
+			false, "",
+			"main.mky:1:7: expected next token to be =, got INT instead\n" +
+				"main.mky:2:5: expected next token to be IDENT, got = instead\n" +
+				"main.mky:3:1: unterminated string literal\n",
+		},
+		{
+			"let m = macro(x) { len(x) };\nputs(1);\nm(2)",
+			false, "", // マクロの展開は評価より先に行う
+			"main.mky: ERROR: len: argument 1 must be STRING or ARRAY, got QUOTE\n\tat len (main.mky:1:23)\n\tat m (main.mky:3:2)\n",
+		},
+		{
+			"puts(1);\nlet f = fn(x) { x + true };\nf(1)",
+			false, "1\n",
+			"main.mky: ERROR: type mismatch: INTEGER + BOOLEAN\n\tat f (main.mky:3:2)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		ok := Run("main.mky", tt.src, &out, &errOut, optimizer.New(optimizer.O0))
+
+		if ok != tt.expectedOK {
+			t.Errorf("Run(%q) returned %t, expected %t", tt.src, ok, tt.expectedOK)
+		}
+		if out.String() != tt.expectedOut {
+			t.Errorf("output wrong for %q. expected=%q, got=%q", tt.src, tt.expectedOut, out.String())
+		}
+		if errOut.String() != tt.expectedErrOut {
+			t.Errorf("error output wrong for %q. expected=%q, got=%q", tt.src, tt.expectedErrOut, errOut.String())
+		}
+	}
+}
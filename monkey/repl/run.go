@@ -0,0 +1,67 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimizer"
+	"monkey/parser"
+	"runtime/debug"
+	"sort"
+)
+
+// filename から読み込んだソースコード src をプログラムとして実行する。
+// REPL と違って最後の式の値は出力せず、puts の出力だけを out に書き出す。
+// 構文解析のエラーはすべて "filename:行:列: メッセージ" の形で errOut に書き出して、評価はしない。
+// 評価中のエラーも errOut に書き出す。どちらかのエラーがあった時は false を返す
+func Run(filename, src string, out, errOut io.Writer, opt *optimizer.Optimizer) (ok bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errors := p.ErrorList(); len(errors) != 0 {
+		// 字句解析のエラーが先に並んでいるので、ファイルの中の位置の順に並べ直す
+		sort.SliceStable(errors, func(i, j int) bool {
+			a, b := errors[i].Pos, errors[j].Pos
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		for _, err := range errors {
+			fmt.Fprintf(errOut, "%s:%s: %s\n", filename, err.Pos, err.Message)
+		}
+		return false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			printInternalError(errOut, r, debug.Stack())
+			ok = false
+		}
+	}()
+
+	env := evaluator.NewEnvironment()
+	env.SetOutput(out)
+	macroEnv := object.NewEnvironment()
+
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		printRuntimeError(errOut, filename, err)
+		return false
+	}
+	optimized := opt.Optimize(expanded.(*ast.Program))
+
+	if errObj, isErr := evaluator.Eval(optimized, env).(*object.Error); isErr {
+		printRuntimeError(errOut, filename, errObj)
+		return false
+	}
+	return true
+}
+
+// 評価中のエラーを、呼び出しの位置にもファイル名をつけて書き出す
+func printRuntimeError(out io.Writer, filename string, err *object.Error) {
+	fmt.Fprintf(out, "%s: ERROR: %s\n", filename, err.Message)
+	for _, f := range err.Stack {
+		fmt.Fprintf(out, "\tat %s (%s:%s)\n", f.Function, filename, f.Pos)
+	}
+}
@@ -1,19 +1,43 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // トークンの先頭の文字がある行(1始まり)
+	Column  int // トークンの先頭の文字がある列(1始まり)
+}
+
+// トークンの先頭の文字の位置を返す
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
+// ソースコード上の位置
+type Position struct {
+	Line   int // 行(1始まり)
+	Column int // 列(1始まり)
+}
+
+// "行:列" の形の文字列を返す
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // ScanComments モードの時だけ生成される
 
 	// 識別子　＋　リテラル
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   //123456
+	IDENT  = "IDENT"  // add, foobar, x, y, ...
+	INT    = "INT"    //123456
+	FLOAT  = "FLOAT"  // 3.14
+	STRING = "STRING" // "foobar"
+	CUSTOM = "CUSTOM" // 10kb, #ff00ff。言語を組み込む側が登録した処理で解釈するリテラル
 
 	//演算子
 	ASSIGN   = "="
@@ -21,23 +45,37 @@ const (
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
+	POWER    = "**"
 	SLASH    = "/"
+	PERCENT  = "%"
+
+	INCREMENT = "++"
+	DECREMENT = "--"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	//デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	//キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -46,6 +84,8 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	FOR      = "FOR"
+	MACRO    = "MACRO"
 )
 
 var keywords = map[string]TokenType{
@@ -56,6 +96,8 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"for":    FOR,
+	"macro":  MACRO,
 }
 
 func LookupIdent(ident string) TokenType {
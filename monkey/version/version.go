@@ -0,0 +1,47 @@
+// インタプリタのバージョンとビルドの情報。monkey --version と組み込み関数の version() が同じものを報告する
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// インタプリタのバージョン。リリース時に -ldflags "-X monkey/version.Version=..." で上書きする
+var Version = "0.1.0-dev"
+
+// 機能の名前と、その機能をこのビルドで使えるかどうか。スクリプトが version() で機能を確かめられるようにする
+var Features = map[string]bool{
+	"macros":  true,  // macro と quote と unquote
+	"vm":      false, // コンパイラと VM はあるが、REPL とファイルの実行はまだ評価器だけを使う
+	"modules": false, // ほかのファイルを読み込む仕組みはまだない
+}
+
+// ビルド情報に埋め込まれた git のコミット。埋め込まれていない時(go run や go test の時など)は "unknown"
+func Commit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// ビルドに使った Go のバージョン。たとえば "go1.18"
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// 使える機能の名前を辞書順に返す
+func EnabledFeatures() []string {
+	names := []string{}
+	for name, enabled := range Features {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
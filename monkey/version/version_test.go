@@ -0,0 +1,22 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnabledFeatures(t *testing.T) {
+	got := strings.Join(EnabledFeatures(), ",")
+	if got != "macros" {
+		t.Errorf("wrong enabled features. want=%q, got=%q", "macros", got)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	if Commit() == "" {
+		t.Errorf("Commit() is empty")
+	}
+	if !strings.HasPrefix(GoVersion(), "go") {
+		t.Errorf("wrong Go version. got=%q", GoVersion())
+	}
+}
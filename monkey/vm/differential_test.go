@@ -0,0 +1,306 @@
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 差分テストで結果を比べる実装。結果は puts の出力に、値の Inspect() か、エラーの時は "error" を続けたものにそろえる。
+// 出力も比べるので、被演算子や引数を評価する順序の違いも見つかる。
+// ほかの実装(たとえば別の言語への変換)を比べる時は、ここに追加すればよい
+var backends = []struct {
+	name string
+	run  func(input string) string
+}{
+	{"evaluator", runEvaluator},
+	{"vm", runVM},
+}
+
+func runEvaluator(input string) string {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+
+	result := evaluator.Eval(parse(input), env)
+	if _, ok := result.(*object.Error); ok {
+		return out.String() + "error"
+	}
+	return out.String() + result.Inspect()
+}
+
+func runVM(input string) string {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return "error"
+	}
+
+	var out bytes.Buffer
+	vm := New(comp.Bytecode())
+	vm.SetOutput(&out)
+	if err := vm.Run(); err != nil {
+		return out.String() + "error"
+	}
+	return out.String() + vm.LastPoppedStackElem().Inspect()
+}
+
+const (
+	differentialSeed     = 539
+	differentialPrograms = 2000
+	regressionFile       = "testdata/differential.txt"
+)
+
+// 文法から無作為に生成した小さなプログラムを、すべての実装で実行して結果を比べる。
+// 食い違ったプログラムは縮めてから回帰ケースのファイルに追記して、テストを失敗させる
+func TestDifferential(t *testing.T) {
+	n := differentialPrograms
+	if testing.Short() {
+		n = 200
+	}
+
+	r := rand.New(rand.NewSource(differentialSeed))
+	reported := map[string]bool{} // 縮めると同じプログラムになることが多いので、一度だけ報告する
+	for i := 0; i < n; i++ {
+		e := genExpr(r, 4, genType(r.Intn(2)))
+		if _, ok := diverges(e.String()); !ok {
+			continue
+		}
+
+		shrunk := shrink(e)
+		if reported[shrunk.String()] {
+			continue
+		}
+		reported[shrunk.String()] = true
+
+		results, _ := diverges(shrunk.String())
+		t.Errorf("backends disagree on %q (shrunk from %q): %s", shrunk, e, results)
+
+		if err := saveRegression(shrunk.String()); err != nil {
+			t.Errorf("could not save regression case: %s", err)
+		}
+	}
+}
+
+// 回帰ケースのファイルにあるプログラムも、すべての実装で結果が一致しなければならない
+func TestDifferentialRegressions(t *testing.T) {
+	f, err := os.Open(regressionFile)
+	if err != nil {
+		t.Fatalf("could not open %s: %s", regressionFile, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if results, ok := diverges(line); ok {
+			t.Errorf("backends disagree on %q: %s", line, results)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("could not read %s: %s", regressionFile, err)
+	}
+}
+
+// すべての実装でプログラムを実行して、結果が一つでも違えば true を返す。結果は "名前=結果" を並べた文字列にして返す
+func diverges(input string) (string, bool) {
+	results := make([]string, len(backends))
+	differ := false
+	for i, b := range backends {
+		results[i] = b.run(input)
+		if results[i] != results[0] {
+			differ = true
+		}
+	}
+
+	pairs := make([]string, len(backends))
+	for i, b := range backends {
+		pairs[i] = b.name + "=" + results[i]
+	}
+	return strings.Join(pairs, ", "), differ
+}
+
+func saveRegression(input string) error {
+	f, err := os.OpenFile(regressionFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, input)
+	return err
+}
+
+// 生成するプログラムの木。整数と真偽値のリテラル、前置演算子、中置演算子、if 式だけからなる。
+// 縮める時に部分木を取り出しやすいように、ソースコードではなく木のまま扱う
+type genNode struct {
+	literal  string     // リテラルの時だけ空でない
+	operator string     // 前置演算子か中置演算子。if 式の時は "if"
+	children []*genNode // 前置演算子は 1 つ、中置演算子は 2 つ、if 式は条件と二つの枝の 3 つ(else がない時は 2 つ)
+}
+
+// if 式の空のブロック。literal も operator も空で、if 式の枝にだけ現れる
+var genEmpty = &genNode{}
+
+func (n *genNode) isEmpty() bool { return n.literal == "" && n.operator == "" }
+
+// 生成する式の型
+type genType int
+
+const (
+	genInt genType = iota
+	genBool
+)
+
+var (
+	genArithmeticOperators = []string{"+", "-", "*", "/", "%"}
+	genComparisonOperators = []string{"<", ">", "<=", ">="}
+	genEqualityOperators   = []string{"==", "!="}
+)
+
+// 深さが depth 以下の、型が want の式を生成する。型の合わない式だけではどの実装でもエラーになって比べる意味がないので、
+// 型の合う式を生成して、まれに型を無視した部分式を混ぜる。if 式の枝は、まれに空のブロックにする
+func genExpr(r *rand.Rand, depth int, want genType) *genNode {
+	if r.Intn(20) == 0 {
+		want = genType(r.Intn(2))
+	}
+
+	if depth == 0 || r.Intn(4) == 0 {
+		if want == genBool {
+			return &genNode{literal: fmt.Sprintf("%t", r.Intn(2) == 0)}
+		}
+		return &genNode{literal: fmt.Sprintf("%d", r.Intn(10))}
+	}
+
+	pick := func(ops []string) string { return ops[r.Intn(len(ops))] }
+
+	if r.Intn(5) == 0 {
+		branch := func() *genNode {
+			if r.Intn(8) == 0 {
+				return genEmpty
+			}
+			return genExpr(r, depth-1, want)
+		}
+		n := &genNode{operator: "if", children: []*genNode{genExpr(r, depth-1, genType(r.Intn(2))), branch()}}
+		if r.Intn(2) == 0 {
+			n.children = append(n.children, branch())
+		}
+		return n
+	}
+
+	if want == genInt {
+		if r.Intn(4) == 0 {
+			return &genNode{operator: "-", children: []*genNode{genExpr(r, depth-1, genInt)}}
+		}
+		return &genNode{operator: pick(genArithmeticOperators), children: []*genNode{
+			genExpr(r, depth-1, genInt), genExpr(r, depth-1, genInt),
+		}}
+	}
+
+	switch r.Intn(3) {
+	case 0:
+		return &genNode{operator: "!", children: []*genNode{genExpr(r, depth-1, genType(r.Intn(2)))}}
+	case 1:
+		return &genNode{operator: pick(genComparisonOperators), children: []*genNode{
+			genExpr(r, depth-1, genInt), genExpr(r, depth-1, genInt),
+		}}
+	default:
+		operand := genType(r.Intn(2))
+		return &genNode{operator: pick(genEqualityOperators), children: []*genNode{
+			genExpr(r, depth-1, operand), genExpr(r, depth-1, operand),
+		}}
+	}
+}
+
+// 優先順位を気にしなくてよいように、リテラル以外はすべて括弧で囲む
+func (n *genNode) String() string {
+	switch {
+	case n.literal != "":
+		return n.literal
+	case n.isEmpty():
+		return ""
+	case n.operator == "if":
+		s := fmt.Sprintf("(if (%s) %s", n.children[0], genBlock(n.children[1]))
+		if len(n.children) == 3 {
+			s += " else " + genBlock(n.children[2])
+		}
+		return s + ")"
+	case len(n.children) == 1:
+		return fmt.Sprintf("(%s%s)", n.operator, n.children[0])
+	default:
+		return fmt.Sprintf("(%s %s %s)", n.children[0], n.operator, n.children[1])
+	}
+}
+
+func genBlock(n *genNode) string {
+	if n.isEmpty() {
+		return "{}"
+	}
+	return "{ " + n.String() + " }"
+}
+
+// 結果が食い違ったままの、できるだけ小さな木を探す。
+// 木を一段小さくした候補のうち、まだ食い違うものが見つかる限りそれに置き換えていく
+func shrink(n *genNode) *genNode {
+	for {
+		smaller := false
+		for _, c := range shrinkCandidates(n) {
+			if _, ok := diverges(c.String()); ok {
+				n = c
+				smaller = true
+				break
+			}
+		}
+		if !smaller {
+			return n
+		}
+	}
+}
+
+// n を一段小さくした木の一覧を返す。子をそのまま使う候補と、子の一つを小さくした候補がある。
+// if 式の枝は空のブロックにする候補もある
+func shrinkCandidates(n *genNode) []*genNode {
+	if n.isEmpty() {
+		return nil
+	}
+	if n.literal != "" {
+		if n.literal != "0" && n.literal != "1" && n.literal != "true" && n.literal != "false" {
+			return []*genNode{{literal: "0"}, {literal: "1"}}
+		}
+		return nil
+	}
+
+	candidates := []*genNode{}
+	for _, child := range n.children {
+		if !child.isEmpty() {
+			candidates = append(candidates, child)
+		}
+	}
+	if n.operator == "if" && len(n.children) == 3 {
+		candidates = append(candidates, &genNode{operator: "if", children: n.children[:2]})
+	}
+
+	for i, child := range n.children {
+		smaller := shrinkCandidates(child)
+		if n.operator == "if" && i > 0 && !child.isEmpty() {
+			smaller = append(smaller, genEmpty)
+		}
+		for _, c := range smaller {
+			children := make([]*genNode, len(n.children))
+			copy(children, n.children)
+			children[i] = c
+			candidates = append(candidates, &genNode{operator: n.operator, children: children})
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// 関数の呼び出し一回分の実行の状態
+type Frame struct {
+	cl          *object.Closure // 実行しているクロージャ
+	ip          int             // 最後に実行した命令の位置。実行ループで先に進めてから読むので、-1 から始める
+	basePointer int             // 呼び出した時のスタックの位置。局所変数はここから並び、戻る時にはスタックをここまで戻す
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
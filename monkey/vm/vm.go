@@ -0,0 +1,511 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// スタックに積める値の数の上限
+const StackSize = 2048
+
+// グローバル変数の数の上限。OpGetGlobal と OpSetGlobal のオペランドは 2 バイトなので、それで表せる数にする
+const GlobalsSize = 65536
+
+// 関数呼び出しの深さの上限
+const MaxFrames = 1024
+
+// 真偽値と null はどこで生成しても同じ値になるように、評価器と同じく一つづつだけ用意しておく
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+// コンパイラが生成したバイトコードを実行するスタックマシン
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // 次に値を積む位置。スタックの一番上の値は stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int // 次に積むフレームの位置。実行中のフレームは frames[framesIndex-1]
+
+	env *object.Environment // 組み込み関数に渡す環境。puts などの出力先だけに使う
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	// トップレベルの命令列も、引数のない関数の本体として実行する
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+
+		env: object.NewEnvironment(),
+	}
+}
+
+// puts などの組み込み関数の出力先を設定する。設定しない時は標準出力になる
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.env.SetOutput(w)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// 前回の実行のグローバル変数を引き継いだ VM を生成する。NewWithState で生成したコンパイラと組み合わせて使う
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// スタックの一番上の値を返す。スタックが空の時は nil
+func (vm *VM) StackTop() object.Object {
+	if vm.sp == 0 {
+		return nil
+	}
+	return vm.stack[vm.sp-1]
+}
+
+// 最後にスタックから取り出した値を返す。式文の値は OpPop で取り除かれるので、実行した結果を確かめる時に使う
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// 命令列を先頭から順に実行する。型が合わない演算やスタックのあふれに出会った時は、そこで実行をやめてエラーを返す
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpLessThan, code.OpLessThanOrEqual:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1 // ループの先頭で進めると pos になる
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.globals[globalIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.push(compiler.Builtins[builtinIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1 // 呼び出した関数もスタックから取り除く
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		default:
+			return fmt.Errorf("unsupported opcode: %s", op)
+		}
+	}
+
+	return nil
+}
+
+// スタックに積まれたクロージャか組み込み関数を、その上に積まれた numArgs 個の引数で呼び出す
+func (vm *VM) executeCall(numArgs int) error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function: %s", callee.Type())
+	}
+}
+
+// 評価器と同じく、引数が足りない仮引数は null になり、余った引数は捨てられる
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	basePointer := vm.sp - numArgs
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	// 渡された引数より後ろの局所変数の領域には前の値が残っているので、null で埋めておく
+	start := numArgs
+	if fn.NumParameters < start {
+		start = fn.NumParameters
+	}
+	for i := start; i < fn.NumLocals; i++ {
+		vm.stack[basePointer+i] = Null
+	}
+
+	frame := NewFrame(cl, basePointer)
+	vm.pushFrame(frame)
+
+	vm.sp = frame.basePointer + fn.NumLocals
+
+	return nil
+}
+
+// 組み込み関数を呼び出して、関数と引数をスタックから取り除いた後に結果を積む。
+// 組み込み関数が返したエラーは、VM のほかのエラーと同じく実行をやめるエラーにする
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result := builtin.Fn(vm.env, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case *object.Error:
+		return fmt.Errorf("%s", result.Message)
+	case *object.Null:
+		return vm.push(Null) // 評価器の null は VM の Null とは別の値なので置き換える
+	case *object.Boolean:
+		return vm.push(nativeBoolToBooleanObject(result.Value))
+	default:
+		return vm.push(result)
+	}
+}
+
+// 定数プールの関数と、スタックに積まれた numFree 個の自由変数の値からクロージャを作って積む
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// 一番上の値を取り出す。取り出した値はスタックに残しておくので、LastPoppedStackElem() で確かめられる
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftValue, leftOk := left.(*object.Integer)
+	rightValue, rightOk := right.(*object.Integer)
+	if !leftOk || !rightOk {
+		return fmt.Errorf("unsupported types for binary operation: %s %s",
+			left.Type(), right.Type())
+	}
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftValue.Value + rightValue.Value
+	case code.OpSub:
+		result = leftValue.Value - rightValue.Value
+	case code.OpMul:
+		result = leftValue.Value * rightValue.Value
+	case code.OpDiv, code.OpMod:
+		if rightValue.Value == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		if op == code.OpDiv {
+			result = leftValue.Value / rightValue.Value
+		} else {
+			result = leftValue.Value % rightValue.Value
+		}
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftValue, leftOk := left.(*object.Integer)
+	rightValue, rightOk := right.(*object.Integer)
+	if leftOk && rightOk {
+		return vm.executeIntegerComparison(op, leftValue.Value, rightValue.Value)
+	}
+
+	// 文字列は組み込み関数が返すたびに作られるので、中身で比べる
+	leftString, leftOk := left.(*object.String)
+	rightString, rightOk := right.(*object.String)
+	if leftOk && rightOk && (op == code.OpEqual || op == code.OpNotEqual) {
+		return vm.push(nativeBoolToBooleanObject((leftString.Value == rightString.Value) == (op == code.OpEqual)))
+	}
+
+	// 真偽値と null は一つづつしかなく、配列などは評価器と同じく同じ値かどうかをポインタで比べる
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(right == left))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(right != left))
+	default:
+		return fmt.Errorf("unknown operator: %s (%s %s)",
+			op, left.Type(), right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerComparison(op code.Opcode, left, right int64) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(left > right))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(left >= right))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(left < right))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(left <= right))
+	default:
+		return fmt.Errorf("unknown operator: %s", op)
+	}
+}
+
+// 評価器の ! と同じく、false と null の時だけ true になる
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	integer, ok := operand.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	}
+
+	return vm.push(&object.Integer{Value: -integer.Value})
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// 評価器と同じく、false と null 以外はすべて真として扱う
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}